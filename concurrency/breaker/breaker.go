@@ -0,0 +1,269 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
+)
+
+var (
+	ErrOpenState       = errors.New("circuit breaker is open")
+	ErrTooManyRequests = errors.New("circuit breaker is half-open and trial calls are exhausted")
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+type StateChangeFunc func(name string, from, to State)
+
+type Breaker struct {
+	name          string
+	isFailure     func(err error) bool
+	onStateChange []StateChangeFunc
+	now           func() time.Time
+
+	mux               sync.Mutex
+	cfg               *Config
+	state             State
+	generation        uint64 // incremented on every state change, results of older generations are ignored
+	openedAt          time.Time
+	window            *rollingWindow
+	halfOpenCalls     int
+	halfOpenSuccesses int
+}
+
+type option func(b *Breaker)
+
+// WithIsFailure decides which errors count as failures, default every error except context.Canceled.
+func WithIsFailure(isFailure func(err error) bool) option {
+	return func(b *Breaker) {
+		if isFailure != nil {
+			b.isFailure = isFailure
+		}
+	}
+}
+
+// WithStateChange adds a callback called on every state change, after the change is logged.
+// It is called with the breaker lock held, so it must not call the breaker.
+func WithStateChange(fn StateChangeFunc) option {
+	return func(b *Breaker) {
+		if fn != nil {
+			b.onStateChange = append(b.onStateChange, fn)
+		}
+	}
+}
+
+func NewBreaker(name string, cfg *Config, opts ...option) *Breaker {
+	cfg = mergeCfgIntoDefault(cfg)
+	b := &Breaker{
+		name:      name,
+		isFailure: defaultIsFailure,
+		now:       time.Now,
+		cfg:       cfg,
+		state:     StateClosed,
+		window:    newRollingWindow(cfg.bucketDuration(), cfg.WindowBuckets),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func defaultIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() State {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.refreshStateLocked(b.now())
+	return b.state
+}
+
+// UpdateConfig applies a new config, e.g. from a hotcfg reload. The counts are reset if the window changed.
+func (b *Breaker) UpdateConfig(cfg *Config) {
+	cfg = mergeCfgIntoDefault(cfg)
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if cfg.WindowMs != b.cfg.WindowMs || cfg.WindowBuckets != b.cfg.WindowBuckets {
+		b.window = newRollingWindow(cfg.bucketDuration(), cfg.WindowBuckets)
+	}
+	b.cfg = cfg
+}
+
+// Allow reserves a call, the caller must call done with the result of the call, only the first call of done counts.
+// It returns ErrOpenState or ErrTooManyRequests if the call is rejected.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := b.now()
+	b.refreshStateLocked(now)
+	switch b.state {
+	case StateOpen:
+		return nil, ErrOpenState
+	case StateHalfOpen:
+		if b.halfOpenCalls >= b.cfg.HalfOpenMaxCalls {
+			return nil, ErrTooManyRequests
+		}
+		b.halfOpenCalls++
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			b.onResult(generation, now, err)
+		})
+	}, nil
+}
+
+// Do runs fn if the breaker allows it. fallback, if not nil, is called with the rejection error
+// or the error of fn, and its result is returned instead.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error, fallback func(ctx context.Context, err error) error) error {
+	_, err := Execute(ctx, b, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, wrapFallback(fallback))
+	return err
+}
+
+func wrapFallback(fallback func(ctx context.Context, err error) error) func(ctx context.Context, err error) (struct{}, error) {
+	if fallback == nil {
+		return nil
+	}
+	return func(ctx context.Context, err error) (struct{}, error) {
+		return struct{}{}, fallback(ctx, err)
+	}
+}
+
+// Execute is the generic form of Breaker.Do. A panic of fn is recorded as a failure and re-panicked.
+func Execute[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error), fallback func(ctx context.Context, err error) (T, error)) (T, error) {
+	done, err := b.Allow()
+	if err != nil {
+		if fallback != nil {
+			return fallback(ctx, err)
+		}
+		var zero T
+		return zero, err
+	}
+
+	value, err := runAndReport(ctx, fn, done)
+	if err != nil && fallback != nil {
+		return fallback(ctx, err)
+	}
+	return value, err
+}
+
+// runAndReport calls done with the result of fn, or with a *util.PanicError if fn panics,
+// so a panicking half-open trial call releases its slot.
+func runAndReport[T any](ctx context.Context, fn func(ctx context.Context) (T, error), done func(err error)) (value T, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			done(util.NewPanicError(p))
+			panic(p)
+		}
+		done(err)
+	}()
+	return fn(ctx)
+}
+
+func (b *Breaker) onResult(generation uint64, start time.Time, err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := b.now()
+	if generation != b.generation {
+		return
+	}
+
+	var panicErr *util.PanicError
+	failure := b.isFailure(err) || errors.As(err, &panicErr)
+	slow := b.cfg.SlowCallMs > 0 && now.Sub(start) >= time.Duration(b.cfg.SlowCallMs)*time.Millisecond
+
+	switch b.state {
+	case StateClosed:
+		b.window.record(now, failure, slow)
+		if b.shouldTripLocked(now) {
+			b.setStateLocked(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failure || slow {
+			b.setStateLocked(StateOpen, now)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.cfg.HalfOpenMaxCalls {
+			b.setStateLocked(StateClosed, now)
+		}
+	}
+}
+
+func (b *Breaker) shouldTripLocked(now time.Time) bool {
+	total, failures, slow := b.window.counts(now)
+	if total < b.cfg.MinRequests {
+		return false
+	}
+	if failures > 0 && float64(failures)*100 >= *b.cfg.ErrorRatePercent*float64(total) {
+		return true
+	}
+	return b.cfg.SlowCallMs > 0 && float64(slow)*100 >= b.cfg.SlowCallRatePercent*float64(total)
+}
+
+// refreshStateLocked moves an open breaker to half-open once the open duration elapsed.
+func (b *Breaker) refreshStateLocked(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= time.Duration(b.cfg.OpenMs)*time.Millisecond {
+		b.setStateLocked(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) setStateLocked(state State, now time.Time) {
+	from := b.state
+	if from == state {
+		return
+	}
+	b.state = state
+	b.generation++
+	b.halfOpenCalls = 0
+	b.halfOpenSuccesses = 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.window.reset()
+	}
+
+	log.Warn("circuit breaker state changed",
+		log.Str("breaker", b.name),
+		log.Str("from", from.String()),
+		log.Str("to", state.String()),
+	)
+	for _, fn := range b.onStateChange {
+		fn(b.name, from, state)
+	}
+}
@@ -0,0 +1,170 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestBreaker(cfg *Config, opts ...option) (*Breaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	b := NewBreaker("test", cfg, opts...)
+	b.now = clock.Now
+	return b, clock
+}
+
+var errDownstream = errors.New("downstream error")
+
+func call(b *Breaker, err error) error {
+	return b.Do(context.Background(), func(ctx context.Context) error { return err }, nil)
+}
+
+func TestBreakerTripsOnErrorRate(t *testing.T) {
+	var transitions []State
+	errorRatePercent := 50.0
+	b, clock := newTestBreaker(&Config{MinRequests: 10, ErrorRatePercent: &errorRatePercent, OpenMs: 1000, HalfOpenMaxCalls: 2},
+		WithStateChange(func(name string, from, to State) { transitions = append(transitions, to) }))
+
+	for i := 0; i < 5; i++ {
+		_ = call(b, nil)
+	}
+	for i := 0; i < 4; i++ {
+		_ = call(b, errDownstream)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("Expected closed below min requests, got %s", b.State())
+	}
+	_ = call(b, errDownstream)
+	if b.State() != StateOpen {
+		t.Fatalf("Expected open at 50%% error rate, got %s", b.State())
+	}
+	if err := call(b, nil); !errors.Is(err, ErrOpenState) {
+		t.Errorf("Expected ErrOpenState, got %v", err)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open after open duration, got %s", b.State())
+	}
+	done1, err1 := b.Allow()
+	done2, err2 := b.Allow()
+	if _, err := b.Allow(); !errors.Is(err, ErrTooManyRequests) || err1 != nil || err2 != nil {
+		t.Fatalf("Expected 2 trial calls then ErrTooManyRequests, got %v %v %v", err1, err2, err)
+	}
+	done1(nil)
+	done2(nil)
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed after successful trial calls, got %s", b.State())
+	}
+
+	want := []State{StateOpen, StateHalfOpen, StateClosed}
+	if len(transitions) != len(want) {
+		t.Fatalf("Expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("Expected transitions %v, got %v", want, transitions)
+		}
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b, clock := newTestBreaker(&Config{MinRequests: 1, OpenMs: 1000})
+	_ = call(b, errDownstream)
+	clock.now = clock.now.Add(time.Second)
+
+	_ = call(b, errDownstream)
+	if b.State() != StateOpen {
+		t.Errorf("Expected a failed trial call to reopen the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerHalfOpenPanicReopens(t *testing.T) {
+	b, clock := newTestBreaker(&Config{MinRequests: 1, OpenMs: 1000, HalfOpenMaxCalls: 1})
+	_ = call(b, errDownstream)
+	clock.now = clock.now.Add(time.Second)
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("Expected the panic to be re-panicked, got %v", p)
+			}
+		}()
+		_ = b.Do(context.Background(), func(ctx context.Context) error { panic("boom") }, nil)
+	}()
+	if b.State() != StateOpen {
+		t.Fatalf("Expected a panicking trial call to reopen the breaker, got %s", b.State())
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if err := call(b, nil); err != nil {
+		t.Errorf("Expected a new trial call after the open duration, got %v", err)
+	}
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed after a successful trial call, got %s", b.State())
+	}
+}
+
+func TestBreakerZeroErrorRateTripsOnAnyFailure(t *testing.T) {
+	zero := 0.0
+	b, _ := newTestBreaker(&Config{MinRequests: 10, ErrorRatePercent: &zero})
+	for i := 0; i < 10; i++ {
+		_ = call(b, nil)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("Expected closed without failures, got %s", b.State())
+	}
+	_ = call(b, errDownstream)
+	if b.State() != StateOpen {
+		t.Errorf("Expected open after a single failure, got %s", b.State())
+	}
+}
+
+func TestBreakerTripsOnSlowCalls(t *testing.T) {
+	b, clock := newTestBreaker(&Config{MinRequests: 4, SlowCallMs: 100, SlowCallRatePercent: 50})
+	for i := 0; i < 4; i++ {
+		done, _ := b.Allow()
+		if i%2 == 0 {
+			clock.now = clock.now.Add(200 * time.Millisecond)
+		}
+		done(nil)
+	}
+	if b.State() != StateOpen {
+		t.Errorf("Expected open at 50%% slow call rate, got %s", b.State())
+	}
+}
+
+func TestBreakerWindowExpires(t *testing.T) {
+	b, clock := newTestBreaker(&Config{WindowMs: 1000, WindowBuckets: 10, MinRequests: 4})
+	for i := 0; i < 3; i++ {
+		_ = call(b, errDownstream)
+	}
+	clock.now = clock.now.Add(2 * time.Second)
+	_ = call(b, errDownstream)
+	if b.State() != StateClosed {
+		t.Errorf("Expected failures outside the window to be forgotten, got %s", b.State())
+	}
+}
+
+func TestBreakerFallback(t *testing.T) {
+	b, _ := newTestBreaker(&Config{MinRequests: 1})
+	_ = call(b, errDownstream)
+
+	value, err := Execute(context.Background(), b, func(ctx context.Context) (string, error) {
+		return "primary", nil
+	}, func(ctx context.Context, err error) (string, error) {
+		return "fallback", nil
+	})
+	if value != "fallback" || err != nil {
+		t.Errorf("Expected fallback result, got (%s, %v)", value, err)
+	}
+}
@@ -0,0 +1,88 @@
+package breaker
+
+import "time"
+
+type Config struct {
+	// rolling window in which calls are counted, split into WindowBuckets buckets
+	WindowMs      int `json:"window_ms" yaml:"window_ms" mapstructure:"window_ms"`
+	WindowBuckets int `json:"window_buckets" yaml:"window_buckets" mapstructure:"window_buckets"`
+	// minimum calls in the window before the breaker may trip
+	MinRequests int `json:"min_requests" yaml:"min_requests" mapstructure:"min_requests"`
+	// trip when the failure rate in the window reaches this percentage (0-100), default 50 when nil,
+	// 0 trips on any failure once MinRequests is reached
+	ErrorRatePercent *float64 `json:"error_rate_percent" yaml:"error_rate_percent" mapstructure:"error_rate_percent"`
+	// calls slower than SlowCallMs are slow calls, 0 disables the slow call threshold
+	SlowCallMs int `json:"slow_call_ms" yaml:"slow_call_ms" mapstructure:"slow_call_ms"`
+	// trip when the slow call rate in the window reaches this percentage (0-100)
+	SlowCallRatePercent float64 `json:"slow_call_rate_percent" yaml:"slow_call_rate_percent" mapstructure:"slow_call_rate_percent"`
+	// how long the breaker stays open before letting trial calls through
+	OpenMs int `json:"open_ms" yaml:"open_ms" mapstructure:"open_ms"`
+	// trial calls allowed in half-open state, all of them must succeed to close the breaker
+	HalfOpenMaxCalls int `json:"half_open_max_calls" yaml:"half_open_max_calls" mapstructure:"half_open_max_calls"`
+}
+
+const (
+	defaultWindowMs            = 10000
+	defaultWindowBuckets       = 10
+	defaultMinRequests         = 20
+	defaultErrorRatePercent    = 50
+	defaultSlowCallRatePercent = 50
+	defaultOpenMs              = 5000
+	defaultHalfOpenMaxCalls    = 5
+)
+
+func NewDefaultConfig() *Config {
+	errorRatePercent := float64(defaultErrorRatePercent)
+	return &Config{
+		WindowMs:            defaultWindowMs,
+		WindowBuckets:       defaultWindowBuckets,
+		MinRequests:         defaultMinRequests,
+		ErrorRatePercent:    &errorRatePercent,
+		SlowCallMs:          0,
+		SlowCallRatePercent: defaultSlowCallRatePercent,
+		OpenMs:              defaultOpenMs,
+		HalfOpenMaxCalls:    defaultHalfOpenMaxCalls,
+	}
+}
+
+// mergeCfgIntoDefault returns a copy of cfg with zero values replaced by defaults.
+func mergeCfgIntoDefault(cfg *Config) *Config {
+	merged := NewDefaultConfig()
+	if cfg == nil {
+		return merged
+	}
+	if cfg.WindowMs > 0 {
+		merged.WindowMs = cfg.WindowMs
+	}
+	if cfg.WindowBuckets > 0 {
+		merged.WindowBuckets = cfg.WindowBuckets
+	}
+	if cfg.MinRequests > 0 {
+		merged.MinRequests = cfg.MinRequests
+	}
+	if cfg.ErrorRatePercent != nil && *cfg.ErrorRatePercent >= 0 {
+		errorRatePercent := *cfg.ErrorRatePercent
+		merged.ErrorRatePercent = &errorRatePercent
+	}
+	if cfg.SlowCallMs > 0 {
+		merged.SlowCallMs = cfg.SlowCallMs
+	}
+	if cfg.SlowCallRatePercent > 0 {
+		merged.SlowCallRatePercent = cfg.SlowCallRatePercent
+	}
+	if cfg.OpenMs > 0 {
+		merged.OpenMs = cfg.OpenMs
+	}
+	if cfg.HalfOpenMaxCalls > 0 {
+		merged.HalfOpenMaxCalls = cfg.HalfOpenMaxCalls
+	}
+	return merged
+}
+
+func (c *Config) bucketDuration() time.Duration {
+	d := time.Duration(c.WindowMs) * time.Millisecond / time.Duration(c.WindowBuckets)
+	if d <= 0 {
+		d = time.Millisecond
+	}
+	return d
+}
@@ -0,0 +1,57 @@
+package breaker
+
+import "time"
+
+type bucket struct {
+	index    int64 // time index of the bucket, used to detect stale buckets
+	total    int
+	failures int
+	slow     int
+}
+
+// rollingWindow counts calls in a ring of time buckets, it is not safe for concurrent use.
+type rollingWindow struct {
+	bucketDuration time.Duration
+	buckets        []bucket
+}
+
+func newRollingWindow(bucketDuration time.Duration, bucketCount int) *rollingWindow {
+	return &rollingWindow{
+		bucketDuration: bucketDuration,
+		buckets:        make([]bucket, bucketCount),
+	}
+}
+
+func (w *rollingWindow) record(now time.Time, failure, slow bool) {
+	index := now.UnixNano() / int64(w.bucketDuration)
+	b := &w.buckets[index%int64(len(w.buckets))]
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	b.total++
+	if failure {
+		b.failures++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+func (w *rollingWindow) counts(now time.Time) (total, failures, slow int) {
+	index := now.UnixNano() / int64(w.bucketDuration)
+	oldest := index - int64(len(w.buckets)) + 1
+	for _, b := range w.buckets {
+		if b.index >= oldest && b.index <= index {
+			total += b.total
+			failures += b.failures
+			slow += b.slow
+		}
+	}
+	return total, failures, slow
+}
+
+func (w *rollingWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
@@ -0,0 +1,80 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrResigned is returned by a Campaign that was stopped by Resign.
+var ErrResigned = errors.New("campaign stopped by resign")
+
+// LeaderElector elects one leader among the replicas campaigning on the same key.
+type LeaderElector interface {
+	// Campaign blocks until this replica is the leader or ctx is done.
+	Campaign(ctx context.Context) error
+	// Resign gives up the leadership, and stops the Campaign calls running at this time, they return ErrResigned.
+	Resign() error
+	IsLeader() bool
+	// Changes delivers true on election and false on resignation or lost leadership, only the latest
+	// value is kept if the receiver is slow. After a lost leadership Campaign has to be called again.
+	Changes() <-chan bool
+}
+
+// LeadershipNotifier keeps the leadership flag and its change channel, for LeaderElector implementations.
+type LeadershipNotifier struct {
+	mux      sync.Mutex
+	leader   bool
+	changes  chan bool
+	resigned chan struct{} // closed and replaced by NotifyResigned
+}
+
+func NewLeadershipNotifier() *LeadershipNotifier {
+	return &LeadershipNotifier{changes: make(chan bool, 1), resigned: make(chan struct{})}
+}
+
+// Resigned returns a channel that is closed by the next NotifyResigned, Campaign takes it when it starts.
+func (n *LeadershipNotifier) Resigned() <-chan struct{} {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.resigned
+}
+
+// NotifyResigned stops the campaigns running at this time, campaigns started later are not affected.
+func (n *LeadershipNotifier) NotifyResigned() {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	close(n.resigned)
+	n.resigned = make(chan struct{})
+}
+
+func (n *LeadershipNotifier) IsLeader() bool {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.leader
+}
+
+func (n *LeadershipNotifier) Changes() <-chan bool {
+	return n.changes
+}
+
+// Set updates the flag and notifies the change, it returns false if the flag did not change.
+func (n *LeadershipNotifier) Set(leader bool) bool {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if n.leader == leader {
+		return false
+	}
+	n.leader = leader
+	select {
+	case n.changes <- leader:
+	default:
+		// replace the value the receiver has not read yet
+		select {
+		case <-n.changes:
+		default:
+		}
+		n.changes <- leader
+	}
+	return true
+}
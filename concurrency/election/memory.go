@@ -0,0 +1,85 @@
+package election
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryElection is an in-process election for tests and local development,
+// the electors created from the same MemoryElection compete for the leadership.
+type MemoryElection struct {
+	mux      sync.Mutex
+	leader   *memoryElector
+	released chan struct{} // closed and replaced when the leader resigns
+}
+
+func NewMemoryElection() *MemoryElection {
+	return &MemoryElection{released: make(chan struct{})}
+}
+
+// Leader returns the id of the current leader, "" if there is none.
+func (m *MemoryElection) Leader() string {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.leader == nil {
+		return ""
+	}
+	return m.leader.id
+}
+
+func (m *MemoryElection) NewElector(id string) LeaderElector {
+	return &memoryElector{
+		LeadershipNotifier: NewLeadershipNotifier(),
+		election:           m,
+		id:                 id,
+	}
+}
+
+type memoryElector struct {
+	*LeadershipNotifier
+	election *MemoryElection
+	id       string
+}
+
+func (e *memoryElector) Campaign(ctx context.Context) error {
+	m := e.election
+	resigned := e.Resigned()
+	for {
+		select {
+		case <-resigned:
+			return ErrResigned
+		default:
+		}
+		m.mux.Lock()
+		if m.leader == nil || m.leader == e {
+			m.leader = e
+			m.mux.Unlock()
+			e.Set(true)
+			return nil
+		}
+		released := m.released
+		m.mux.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resigned:
+			return ErrResigned
+		case <-released:
+		}
+	}
+}
+
+func (e *memoryElector) Resign() error {
+	e.NotifyResigned()
+	m := e.election
+	m.mux.Lock()
+	if m.leader == e {
+		m.leader = nil
+		close(m.released)
+		m.released = make(chan struct{})
+	}
+	m.mux.Unlock()
+	e.Set(false)
+	return nil
+}
@@ -0,0 +1,64 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryElection(t *testing.T) {
+	m := NewMemoryElection()
+	a, b := m.NewElector("a"), m.NewElector("b")
+
+	if err := a.Campaign(context.Background()); err != nil || !a.IsLeader() {
+		t.Fatalf("Expected a to be the leader, got %v", err)
+	}
+	if leader := <-a.Changes(); !leader {
+		t.Errorf("Expected a change to leader")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Campaign(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if b.IsLeader() || m.Leader() != "a" {
+		t.Fatalf("Expected b to wait while a is the leader")
+	}
+
+	_ = a.Resign()
+	if err := <-done; err != nil || m.Leader() != "b" {
+		t.Errorf("Expected b to take over, got %v (leader %q)", err, m.Leader())
+	}
+	if leader := <-a.Changes(); leader {
+		t.Errorf("Expected a change to follower")
+	}
+}
+
+func TestResignStopsCampaign(t *testing.T) {
+	m := NewMemoryElection()
+	a, b := m.NewElector("a"), m.NewElector("b")
+	_ = a.Campaign(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Campaign(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_ = b.Resign()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrResigned) {
+			t.Errorf("Expected ErrResigned, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Resign to stop the campaign")
+	}
+
+	// a later campaign is not affected by the earlier Resign
+	_ = a.Resign()
+	if err := b.Campaign(context.Background()); err != nil || !b.IsLeader() {
+		t.Errorf("Expected b to win a new campaign, got %v", err)
+	}
+}
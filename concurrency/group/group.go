@@ -0,0 +1,117 @@
+package group
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gw-gong/gwkit-go/util"
+)
+
+// Group runs functions in goroutines sharing one context, which is cancelled on the first error.
+// The context is derived from the parent, so rid/tid and other trace values reach every function.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	sem    chan struct{}
+
+	errOnce sync.Once
+	err     error
+}
+
+type option func(g *Group)
+
+// WithLimit caps the number of functions running at the same time, Go blocks while the cap is reached.
+func WithLimit(limit int) option {
+	return func(g *Group) {
+		if limit > 0 {
+			g.sem = make(chan struct{}, limit)
+		}
+	}
+}
+
+func New(ctx context.Context, opts ...option) (*Group, context.Context) {
+	groupCtx, cancel := context.WithCancelCause(ctx)
+	g := &Group{ctx: groupCtx, cancel: cancel}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g, groupCtx
+}
+
+// Go runs fn in a new goroutine, a panic in fn is logged and returned by Wait as *util.PanicError.
+// Functions started after the first error still run, they should check ctx.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start(fn)
+}
+
+// TryGo is like Go, but returns false instead of blocking when the limit is reached.
+func (g *Group) TryGo(fn func(ctx context.Context) error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(fn)
+	return true
+}
+
+func (g *Group) start(fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			if g.sem != nil {
+				<-g.sem
+			}
+			g.wg.Done()
+		}()
+
+		var err error
+		util.WithRecover(func() {
+			err = fn(g.ctx)
+		}, func(panicErr interface{}) {
+			util.DefaultPanicWithCtx(g.ctx, panicErr)
+			err = util.NewPanicError(panicErr)
+		})
+		if err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// Wait waits for all functions and returns the first error.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	return g.err
+}
+
+// Map calls fn for every item with at most limit calls at the same time (limit <= 0 means no limit),
+// and returns the results in the order of items. On error the results of the other items are dropped.
+func Map[T, R any](ctx context.Context, items []T, limit int, fn func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	g, _ := New(ctx, WithLimit(limit))
+	results := make([]R, len(items))
+	for i, item := range items {
+		i, item := i, item
+		g.Go(func(ctx context.Context) error {
+			result, err := fn(ctx, item)
+			if err != nil {
+				return err
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,92 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/util"
+	"github.com/gw-gong/gwkit-go/util/trace"
+)
+
+func TestGroupCancelsOnFirstError(t *testing.T) {
+	g, ctx := New(context.Background())
+	errFirst := errors.New("first")
+
+	g.Go(func(ctx context.Context) error {
+		return errFirst
+	})
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("expected the context to be cancelled")
+		}
+	})
+
+	if err := g.Wait(); !errors.Is(err, errFirst) {
+		t.Errorf("Expected the first error, got %v", err)
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, errFirst) {
+		t.Errorf("Expected the context cause to be the first error, got %v", cause)
+	}
+}
+
+func TestGroupConvertsPanics(t *testing.T) {
+	g, _ := New(context.Background())
+	g.Go(func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	var panicErr *util.PanicError
+	if err := g.Wait(); !errors.As(err, &panicErr) || len(panicErr.Stack) == 0 {
+		t.Errorf("Expected *util.PanicError with a stack, got %v", err)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	g, _ := New(context.Background(), WithLimit(2))
+	var running, maxRunning atomic.Int32
+	for i := 0; i < 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := running.Add(1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+	}
+	if g.TryGo(func(ctx context.Context) error { return nil }) {
+		t.Errorf("Expected TryGo to fail while the limit is reached")
+	}
+	_ = g.Wait()
+	if maxRunning.Load() > 2 {
+		t.Errorf("Expected at most 2 running functions, got %d", maxRunning.Load())
+	}
+}
+
+func TestMapKeepsOrderAndTraceValues(t *testing.T) {
+	ctx := trace.SetRequestIDToCtx(context.Background(), "rid-1")
+	results, err := Map(ctx, []int{1, 2, 3, 4, 5}, 2, func(ctx context.Context, item int) (string, error) {
+		time.Sleep(time.Duration(5-item) * time.Millisecond)
+		return fmt.Sprintf("%s-%d", trace.GetRequestIDFromCtx(ctx), item*item), nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{"rid-1-1", "rid-1-4", "rid-1-9", "rid-1-16", "rid-1-25"}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, results)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/util"
+)
+
+// Future is the pending result of a function submitted by SubmitFunc.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// Done is closed once the result is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the result is available or ctx is done, a recovered panic is returned as *util.PanicError.
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (f *Future[T]) complete(value T, err error) {
+	f.value = value
+	f.err = err
+	close(f.done)
+}
+
+type funcWork[T any] struct {
+	parent context.Context
+	fn     func(ctx context.Context) (T, error)
+	future *Future[T]
+}
+
+func (w *funcWork[T]) Do() {
+	_ = w.doErr()
+}
+
+func (w *funcWork[T]) doErr() error {
+	if err := w.parent.Err(); err != nil {
+		var zero T
+		w.future.complete(zero, err)
+		return err
+	}
+
+	var (
+		value T
+		err   error
+	)
+	ctx, cancel := newWorkCtx(w.parent)
+	defer cancel()
+	util.WithRecover(func() {
+		value, err = w.fn(ctx)
+	}, func(p interface{}) {
+		util.DefaultPanicWithCtx(ctx, p)
+		err = util.NewPanicError(p)
+	})
+	w.future.complete(value, err)
+	return err
+}
+
+// SubmitFunc submits fn to wp and returns a Future for its result. Like SubmitCtxFunc, fn runs with the trace info and
+// the deadline of ctx, and is skipped with ctx.Err() if ctx is already done when a worker picks it up.
+func SubmitFunc[T any](ctx context.Context, wp ManagedWorkerPool, fn func(ctx context.Context) (T, error)) (*Future[T], error) {
+	future := newFuture[T]()
+	work := &funcWork[T]{parent: ctx, fn: fn, future: future}
+	if err := wp.SubmitCtx(ctx, work); err != nil {
+		return nil, err
+	}
+	return future, nil
+}
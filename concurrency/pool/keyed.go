@@ -0,0 +1,145 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gw-gong/gwkit-go/util"
+)
+
+// Keyed work of the same key is kept in a per-key FIFO, and at most one keyedRunner per key is scheduled
+// on the normal queue. The runner executes the key's work one by one on its worker until the FIFO is empty,
+// so a busy key never blocks other keys the way a fixed key -> shard mapping does.
+
+type keyedEntry struct {
+	work Work
+}
+
+type keyedQueue struct {
+	entries []*keyedEntry
+}
+
+type keyedRunner struct {
+	wp  *workerPoolImpl
+	key string
+}
+
+// Do is never called by the pool, runners are executed through run.
+func (r *keyedRunner) Do() {
+	r.run()
+}
+
+func (r *keyedRunner) run() {
+	for {
+		r.wp.keyedMux.Lock()
+		queue, ok := r.wp.keyedQueues[r.key]
+		if !ok {
+			// taken by Shutdown
+			r.wp.keyedMux.Unlock()
+			return
+		}
+		if len(queue.entries) == 0 {
+			delete(r.wp.keyedQueues, r.key)
+			r.wp.keyedMux.Unlock()
+			return
+		}
+		entry := queue.entries[0]
+		queue.entries[0] = nil
+		queue.entries = queue.entries[1:]
+		r.wp.keyedMux.Unlock()
+
+		r.wp.execute(entry.work)
+	}
+}
+
+// SubmitKeyed queues at most channelSize work per key, the wait for a free slot only applies
+// to the first work of an idle key, which has to schedule a runner.
+func (wp *workerPoolImpl) SubmitKeyed(ctx context.Context, key string, work Work) error {
+	if atomic.LoadInt32(&wp.closed) == 1 {
+		return ErrPoolClosed
+	}
+
+	entry := &keyedEntry{work: work}
+
+	wp.keyedMux.Lock()
+	if queue, ok := wp.keyedQueues[key]; ok {
+		defer wp.keyedMux.Unlock()
+		if len(queue.entries) >= wp.channelSize {
+			return fmt.Errorf("keyed queue of key %s is full, queue length: %d", key, len(queue.entries))
+		}
+		queue.entries = append(queue.entries, entry)
+		return nil
+	}
+	queue := &keyedQueue{entries: []*keyedEntry{entry}}
+	wp.keyedQueues[key] = queue
+	wp.keyedMux.Unlock()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wp.timeoutSubmit)
+		defer cancel()
+	}
+
+	runner := &keyedRunner{wp: wp, key: key}
+	ok, err := wp.enqueue(wp.queues[PriorityNormal], runner, ctx.Done())
+	if ok {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("failed to submit keyed work, queue length: %d: %w", wp.QueueLength(), ctx.Err())
+	}
+
+	wp.keyedMux.Lock()
+	defer wp.keyedMux.Unlock()
+	if !queue.remove(entry) {
+		// already taken by Shutdown and returned as unprocessed
+		return nil
+	}
+	if len(queue.entries) == 0 {
+		if wp.keyedQueues[key] == queue {
+			delete(wp.keyedQueues, key)
+		}
+		return err
+	}
+	// other work of the key was accepted meanwhile, it still needs a runner. The wait ends when the pool starts
+	// closing, the work of the key then stays in keyedQueues and Shutdown returns it as unprocessed.
+	go util.WithRecover(func() {
+		_, _ = wp.enqueue(wp.queues[PriorityNormal], runner, wp.closingChan)
+	})
+	return err
+}
+
+func (q *keyedQueue) remove(entry *keyedEntry) bool {
+	for i, e := range q.entries {
+		if e == entry {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (wp *workerPoolImpl) keyedPending() int {
+	wp.keyedMux.Lock()
+	defer wp.keyedMux.Unlock()
+	pending := 0
+	for _, queue := range wp.keyedQueues {
+		pending += len(queue.entries)
+	}
+	return pending
+}
+
+// takeKeyedPending removes all keyed work that has not started, running runners stop after their current work.
+func (wp *workerPoolImpl) takeKeyedPending() []Work {
+	wp.keyedMux.Lock()
+	defer wp.keyedMux.Unlock()
+	var pending []Work
+	for key, queue := range wp.keyedQueues {
+		for _, entry := range queue.entries {
+			pending = append(pending, entry.work)
+		}
+		delete(wp.keyedQueues, key)
+	}
+	return pending
+}
@@ -0,0 +1,45 @@
+package pool
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	priorityLevels = 3
+)
+
+const (
+	DefaultAgingEvery = 8
+)
+
+// WithPriorityQueues gives each priority its own queue of channelSize, workers take high priority work first.
+// To protect lower priorities from starvation, every agingEvery-th dequeue scans the queues from low to high,
+// so a backlog of lower priority work still gets at least 1/agingEvery of the workers' throughput.
+// agingEvery <= 0 means DefaultAgingEvery.
+func WithPriorityQueues(agingEvery int) option {
+	return func(wp *workerPoolImpl) {
+		if agingEvery <= 0 {
+			agingEvery = DefaultAgingEvery
+		}
+		wp.agingEvery = uint64(agingEvery)
+		wp.queues[PriorityHigh] = make(chan Work, wp.channelSize)
+		wp.queues[PriorityLow] = make(chan Work, wp.channelSize)
+	}
+}
+
+// queueOf falls back to the normal queue for unknown priorities or without WithPriorityQueues.
+func (wp *workerPoolImpl) queueOf(priority Priority) chan Work {
+	if priority < PriorityLow || priority > PriorityHigh || wp.queues[priority] == nil {
+		return wp.queues[PriorityNormal]
+	}
+	return wp.queues[priority]
+}
+
+func (wp *workerPoolImpl) queuesInDequeueOrder() [priorityLevels]chan Work {
+	if wp.agingEvery > 0 && wp.dequeueSeq.Add(1)%wp.agingEvery == 0 {
+		return [priorityLevels]chan Work{wp.queues[PriorityLow], wp.queues[PriorityNormal], wp.queues[PriorityHigh]}
+	}
+	return [priorityLevels]chan Work{wp.queues[PriorityHigh], wp.queues[PriorityNormal], wp.queues[PriorityLow]}
+}
@@ -1,5 +1,52 @@
 package pool
 
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/util"
+	"github.com/gw-gong/gwkit-go/util/trace"
+)
+
 type Work interface {
 	Do()
 }
+
+// ctxWork runs fn with a copy of the trace info and the deadline of the submitter, and logs panics with it.
+// It is skipped if the ctx of the submitter is already done when a worker picks it up.
+type ctxWork struct {
+	parent context.Context
+	fn     func(ctx context.Context)
+}
+
+func newCtxWork(ctx context.Context, fn func(ctx context.Context)) *ctxWork {
+	return &ctxWork{parent: ctx, fn: fn}
+}
+
+// newWorkCtx keeps the trace info and the deadline of parent, but not its cancellation, so the work still
+// runs to the end if the submitter returns early, but not past the deadline the submitter asked for.
+func newWorkCtx(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx := trace.CopyCtx(parent)
+	if deadline, ok := parent.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+	return ctx, func() {}
+}
+
+func (w *ctxWork) Do() {
+	_ = w.doErr()
+}
+
+func (w *ctxWork) doErr() (err error) {
+	if err := w.parent.Err(); err != nil {
+		return err
+	}
+	ctx, cancel := newWorkCtx(w.parent)
+	defer cancel()
+	util.WithRecover(func() {
+		w.fn(ctx)
+	}, func(p interface{}) {
+		util.DefaultPanicWithCtx(ctx, p)
+		err = util.NewPanicError(p)
+	})
+	return err
+}
@@ -1,17 +1,24 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/gw-gong/gwkit-go/log"
 	"github.com/gw-gong/gwkit-go/util"
 )
 
 const (
 	DefaultTimeoutSubmit = time.Second * 5
+	DefaultIdleTimeout   = time.Minute
+)
+
+var (
+	ErrPoolClosed = errors.New("worker pool is closed")
 )
 
 type WorkerPool interface {
@@ -20,11 +27,74 @@ type WorkerPool interface {
 	Close()
 }
 
+// ManagedWorkerPool is the WorkerPool returned by NewWorkerPool, it adds ctx aware submission, priorities,
+// keyed ordering, resizing, stats and shutdown. WorkerPool stays small, so existing implementations and mocks keep working.
+type ManagedWorkerPool interface {
+	WorkerPool
+	// SubmitCtx waits for a free slot until ctx is done, or timeoutSubmit if ctx has no deadline.
+	SubmitCtx(ctx context.Context, work Work) error
+	// SubmitCtxFunc behaves like SubmitCtx, fn runs with trace.CopyCtx(ctx) bounded by the deadline of ctx, so logs
+	// keep the rid/tid of the caller while fn is detached from the caller's cancellation once started. fn is skipped
+	// if ctx is already done when a worker picks it up.
+	SubmitCtxFunc(ctx context.Context, fn func(ctx context.Context)) error
+	// SubmitPriority behaves like SubmitCtx, the priority only takes effect with WithPriorityQueues.
+	SubmitPriority(ctx context.Context, priority Priority, work Work) error
+	// SubmitKeyed runs work with the same key sequentially in submission order, while different keys run in parallel.
+	SubmitKeyed(ctx context.Context, key string, work Work) error
+	// WorkerCount returns the number of running worker goroutines.
+	WorkerCount() int
+	// Resize sets the maximum number of workers at runtime, e.g. from a hotcfg reload.
+	// Fixed pools keep exactly n workers. Elastic pools keep their configured minimum, they run n workers
+	// while n is not above it and are elastic again once n grows past it.
+	Resize(n int) error
+	// Stats returns a snapshot of the pool counters.
+	Stats() Stats
+	// Shutdown stops accepting work and drains the queue until ctx is done, then returns the queued work
+	// that was not started, so the caller can persist it. Work still running at the deadline is not waited for.
+	Shutdown(ctx context.Context) (unprocessed []Work, err error)
+}
+
+type Stats struct {
+	Workers   int    // running worker goroutines
+	Running   int    // work being executed
+	Queued    int    // work waiting in the queues, including keyed work
+	Completed uint64 // work finished without error or panic
+	Failed    uint64 // work that returned an error, only known for SubmitFunc
+	Panicked  uint64 // work that panicked
+}
+
 type workerPoolImpl struct {
 	wg            sync.WaitGroup
 	closed        int32
-	workChan      chan Work
+	channelSize   int
+	queues        [priorityLevels]chan Work // only the normal queue exists without WithPriorityQueues
+	agingEvery    uint64                    // every agingEvery-th dequeue scans the queues from low to high priority
+	dequeueSeq    atomic.Uint64
+	closingChan   chan struct{}
+	abortChan     chan struct{}
 	timeoutSubmit time.Duration
+
+	// submitMux is held for reading while sending to the queues, Shutdown takes it for writing to close them.
+	submitMux sync.RWMutex
+	// dequeueMux is held for reading while a worker takes work from the queues,
+	// Shutdown takes it for writing so that no work is dequeued while it collects the unprocessed work.
+	dequeueMux  sync.RWMutex
+	handedBack  []Work // work dequeued after the shutdown deadline, guarded by mux
+	idleWorkers atomic.Int32
+	running     atomic.Int32
+	completed   atomic.Uint64
+	failed      atomic.Uint64
+	panicked    atomic.Uint64
+
+	keyedMux    sync.Mutex
+	keyedQueues map[string]*keyedQueue
+
+	mux         sync.Mutex
+	workers     int
+	minWorkers  int // 0 means fixed pool, kept as configured, see lowerBoundLocked
+	maxWorkers  int
+	idleTimeout time.Duration
+	shrinkChan  chan struct{} // closed and replaced by Resize when there are more workers than the new max
 }
 
 type option func(wp *workerPoolImpl)
@@ -37,7 +107,27 @@ func WithTimeoutSubmit(timeoutSubmit time.Duration) option {
 	}
 }
 
-func NewWorkerPool(channelSize, workerPoolSize int, opts ...option) (WorkerPool, error) {
+// WithMinWorkers makes the pool elastic: it starts minWorkers workers, grows up to workerPoolSize
+// when the queue is backing up, and shrinks back after workers stay idle for the idle timeout.
+func WithMinWorkers(minWorkers int) option {
+	return func(wp *workerPoolImpl) {
+		if minWorkers > 0 {
+			wp.minWorkers = minWorkers
+		}
+	}
+}
+
+// WithIdleTimeout sets how long an elastic worker waits for work before exiting, default DefaultIdleTimeout.
+func WithIdleTimeout(idleTimeout time.Duration) option {
+	return func(wp *workerPoolImpl) {
+		if idleTimeout > 0 {
+			wp.idleTimeout = idleTimeout
+		}
+	}
+}
+
+// NewWorkerPool starts a pool of workerPoolSize workers, see WithMinWorkers for an elastic pool.
+func NewWorkerPool(channelSize, workerPoolSize int, opts ...option) (ManagedWorkerPool, error) {
 	if channelSize <= 0 {
 		return nil, errors.New("channelSize must be greater than 0")
 	}
@@ -48,54 +138,414 @@ func NewWorkerPool(channelSize, workerPoolSize int, opts ...option) (WorkerPool,
 	wp := &workerPoolImpl{
 		wg:            sync.WaitGroup{},
 		closed:        0,
-		workChan:      make(chan Work, channelSize),
+		channelSize:   channelSize,
+		closingChan:   make(chan struct{}),
+		abortChan:     make(chan struct{}),
 		timeoutSubmit: DefaultTimeoutSubmit,
+		keyedQueues:   make(map[string]*keyedQueue),
+		maxWorkers:    workerPoolSize,
+		idleTimeout:   DefaultIdleTimeout,
+		shrinkChan:    make(chan struct{}),
 	}
+	wp.queues[PriorityNormal] = make(chan Work, channelSize)
 
 	for _, opt := range opts {
 		opt(wp)
 	}
 
-	wp.run(workerPoolSize)
+	wp.mux.Lock()
+	wp.spawnLocked(wp.lowerBoundLocked() - wp.workers)
+	wp.mux.Unlock()
 
 	return wp, nil
 }
 
-func (wp *workerPoolImpl) run(workerPoolSize int) {
-	for i := 0; i < workerPoolSize; i++ {
+func (wp *workerPoolImpl) isElasticLocked() bool {
+	return wp.minWorkers > 0
+}
+
+// lowerBoundLocked returns the number of workers that never retire for being idle,
+// an elastic pool with a max not above its min runs like a fixed pool.
+func (wp *workerPoolImpl) lowerBoundLocked() int {
+	if wp.isElasticLocked() {
+		return min(wp.minWorkers, wp.maxWorkers)
+	}
+	return wp.maxWorkers
+}
+
+func (wp *workerPoolImpl) spawnLocked(n int) {
+	if atomic.LoadInt32(&wp.closed) == 1 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		wp.workers++
 		wp.wg.Add(1)
-		go func() {
-			defer wp.wg.Done()
-			for work := range wp.workChan {
-				util.WithRecover(work.Do)
+		go wp.worker(wp.isElasticLocked())
+	}
+}
+
+// retire decrements the worker count if it is above limit, the caller must exit if true is returned.
+func (wp *workerPoolImpl) retire(limit int) bool {
+	wp.mux.Lock()
+	defer wp.mux.Unlock()
+	if wp.workers > limit {
+		wp.workers--
+		return true
+	}
+	return false
+}
+
+// retireAboveMax retires the worker if the pool has more workers than its max. Otherwise it returns the channel
+// Resize closes when the max shrinks below the worker count, taken under the same lock so no shrink is missed.
+func (wp *workerPoolImpl) retireAboveMax() (shrinkC <-chan struct{}, retired bool) {
+	wp.mux.Lock()
+	defer wp.mux.Unlock()
+	if wp.workers > wp.maxWorkers {
+		wp.workers--
+		return nil, true
+	}
+	return wp.shrinkChan, false
+}
+
+func (wp *workerPoolImpl) lowerBound() int {
+	wp.mux.Lock()
+	defer wp.mux.Unlock()
+	return wp.lowerBoundLocked()
+}
+
+func (wp *workerPoolImpl) worker(elastic bool) {
+	defer wp.wg.Done()
+
+	var idleC <-chan time.Time
+	var idleTimer *time.Timer
+	if elastic {
+		idleTimer = time.NewTimer(wp.idleTimeout)
+		defer idleTimer.Stop()
+		idleC = idleTimer.C
+	}
+
+	for {
+		// checked after every work and before waiting, so the pool shrinks even if no work arrives
+		shrinkC, retired := wp.retireAboveMax()
+		if retired {
+			return
+		}
+
+		work, signal := wp.dequeue(idleC, shrinkC)
+		switch signal {
+		case dequeueWork:
+			if runner, ok := work.(*keyedRunner); ok {
+				runner.run()
+			} else {
+				wp.execute(work)
+			}
+			if idleTimer != nil {
+				idleTimer.Reset(wp.idleTimeout)
 			}
-		}()
+		case dequeueExit:
+			wp.retire(0)
+			return
+		case dequeueShrink:
+			// re-check the max limit at the top of the loop
+		case dequeueIdle:
+			if wp.retire(wp.lowerBound()) {
+				return
+			}
+			idleTimer.Reset(wp.idleTimeout)
+		}
 	}
 }
 
-func (wp *workerPoolImpl) Submit(work Work) error {
+type dequeueSignal int
+
+const (
+	dequeueWork dequeueSignal = iota
+	dequeueExit
+	dequeueShrink
+	dequeueIdle
+)
+
+func (wp *workerPoolImpl) dequeue(idleC <-chan time.Time, shrinkC <-chan struct{}) (Work, dequeueSignal) {
+	wp.dequeueMux.RLock()
+	defer wp.dequeueMux.RUnlock()
+
+	// prefer the queues in priority order, the blocking select below picks randomly among ready queues
+	work, ok, allClosed := wp.tryDequeue()
+	if !ok {
+		if allClosed {
+			return nil, dequeueExit
+		}
+
+		wp.idleWorkers.Add(1)
+		var open bool
+		select {
+		case work, open = <-wp.queues[PriorityHigh]:
+		case work, open = <-wp.queues[PriorityNormal]:
+		case work, open = <-wp.queues[PriorityLow]:
+		case <-wp.abortChan:
+			wp.idleWorkers.Add(-1)
+			return nil, dequeueExit
+		case <-shrinkC:
+			wp.idleWorkers.Add(-1)
+			return nil, dequeueShrink
+		case <-idleC:
+			wp.idleWorkers.Add(-1)
+			return nil, dequeueIdle
+		}
+		wp.idleWorkers.Add(-1)
+		if !open {
+			// the queues are closed together, take what is left in the other queues
+			if work, ok, _ = wp.tryDequeue(); !ok {
+				return nil, dequeueExit
+			}
+		}
+	}
+
+	select {
+	case <-wp.abortChan:
+		wp.mux.Lock()
+		wp.handedBack = append(wp.handedBack, work)
+		wp.mux.Unlock()
+		return nil, dequeueExit
+	default:
+	}
+	return work, dequeueWork
+}
+
+// tryDequeue takes work without blocking, allClosed reports that every queue is closed and drained.
+func (wp *workerPoolImpl) tryDequeue() (work Work, ok bool, allClosed bool) {
+	allClosed = true
+	for _, queue := range wp.queuesInDequeueOrder() {
+		if queue == nil {
+			continue
+		}
+		select {
+		case w, open := <-queue:
+			if open {
+				return w, true, false
+			}
+		default:
+			allClosed = false
+		}
+	}
+	return nil, false, allClosed
+}
+
+// errWork is implemented by work that reports its result, so Stats can count failures.
+type errWork interface {
+	doErr() error
+}
+
+func (wp *workerPoolImpl) execute(work Work) {
+	wp.running.Add(1)
+	defer wp.running.Add(-1)
+
+	var err error
+	util.WithRecover(func() {
+		if ew, ok := work.(errWork); ok {
+			err = ew.doErr()
+			return
+		}
+		work.Do()
+	}, func(p interface{}) {
+		util.DefaultPanicHandler(p)
+		err = util.NewPanicError(p)
+	})
+
+	var panicErr *util.PanicError
+	switch {
+	case err == nil:
+		wp.completed.Add(1)
+	case errors.As(err, &panicErr):
+		wp.panicked.Add(1)
+	default:
+		wp.failed.Add(1)
+	}
+}
+
+// maybeGrow starts one more worker of an elastic pool when more work is queued than idle workers can take.
+func (wp *workerPoolImpl) maybeGrow() {
+	wp.mux.Lock()
+	defer wp.mux.Unlock()
+	if wp.isElasticLocked() && wp.workers < wp.maxWorkers && wp.QueueLength() > int(wp.idleWorkers.Load()) {
+		wp.spawnLocked(1)
+	}
+}
+
+// enqueue sends work to queue, it returns false if done is closed first, and ErrPoolClosed once the pool is closing.
+func (wp *workerPoolImpl) enqueue(queue chan Work, work Work, done <-chan struct{}) (bool, error) {
+	wp.submitMux.RLock()
+	defer wp.submitMux.RUnlock()
 	if atomic.LoadInt32(&wp.closed) == 1 {
-		return errors.New("worker pool is closed")
+		return false, ErrPoolClosed
 	}
 
-	timeout := time.NewTimer(wp.timeoutSubmit)
-	defer timeout.Stop()
+	select {
+	case queue <- work:
+		wp.maybeGrow()
+		return true, nil
+	default:
+	}
 
+	wp.maybeGrow()
 	select {
-	case wp.workChan <- work:
-	case <-timeout.C:
+	case queue <- work:
+		return true, nil
+	case <-done:
+		return false, nil
+	case <-wp.closingChan:
+		return false, ErrPoolClosed
+	}
+}
+
+func (wp *workerPoolImpl) Submit(work Work) error {
+	if atomic.LoadInt32(&wp.closed) == 1 {
+		return ErrPoolClosed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wp.timeoutSubmit)
+	defer cancel()
+
+	ok, err := wp.enqueue(wp.queues[PriorityNormal], work, ctx.Done())
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return fmt.Errorf("timeout(%v) to submit work, workChan is full, queue length: %d", wp.timeoutSubmit, wp.QueueLength())
 	}
 	return nil
 }
 
+func (wp *workerPoolImpl) SubmitCtx(ctx context.Context, work Work) error {
+	return wp.SubmitPriority(ctx, PriorityNormal, work)
+}
+
+func (wp *workerPoolImpl) SubmitCtxFunc(ctx context.Context, fn func(ctx context.Context)) error {
+	return wp.SubmitPriority(ctx, PriorityNormal, newCtxWork(ctx, fn))
+}
+
+func (wp *workerPoolImpl) SubmitPriority(ctx context.Context, priority Priority, work Work) error {
+	if atomic.LoadInt32(&wp.closed) == 1 {
+		return ErrPoolClosed
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wp.timeoutSubmit)
+		defer cancel()
+	}
+
+	ok, err := wp.enqueue(wp.queueOf(priority), work, ctx.Done())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("failed to submit work, queue length: %d: %w", wp.QueueLength(), ctx.Err())
+	}
+	return nil
+}
+
 func (wp *workerPoolImpl) QueueLength() int {
-	return len(wp.workChan)
+	length := 0
+	for _, queue := range wp.queues {
+		length += len(queue)
+	}
+	return length
 }
 
-func (wp *workerPoolImpl) Close() {
-	if atomic.CompareAndSwapInt32(&wp.closed, 0, 1) {
-		close(wp.workChan)
+func (wp *workerPoolImpl) WorkerCount() int {
+	wp.mux.Lock()
+	defer wp.mux.Unlock()
+	return wp.workers
+}
+
+func (wp *workerPoolImpl) Resize(n int) error {
+	if n <= 0 {
+		return errors.New("worker pool size must be greater than 0")
+	}
+	if atomic.LoadInt32(&wp.closed) == 1 {
+		return ErrPoolClosed
+	}
+
+	wp.mux.Lock()
+	defer wp.mux.Unlock()
+	wp.maxWorkers = n
+	wp.spawnLocked(wp.lowerBoundLocked() - wp.workers)
+	if wp.workers > n {
+		// wake the idle workers to re-check the max, busy ones check it after their current work
+		close(wp.shrinkChan)
+		wp.shrinkChan = make(chan struct{})
+	}
+	return nil
+}
+
+func (wp *workerPoolImpl) Stats() Stats {
+	return Stats{
+		Workers:   wp.WorkerCount(),
+		Running:   int(wp.running.Load()),
+		Queued:    wp.QueueLength() + wp.keyedPending(),
+		Completed: wp.completed.Load(),
+		Failed:    wp.failed.Load(),
+		Panicked:  wp.panicked.Load(),
+	}
+}
+
+func (wp *workerPoolImpl) Shutdown(ctx context.Context) (unprocessed []Work, err error) {
+	if !atomic.CompareAndSwapInt32(&wp.closed, 0, 1) {
+		return nil, ErrPoolClosed
+	}
+	close(wp.closingChan)
+	wp.submitMux.Lock()
+	for _, queue := range wp.queues {
+		if queue != nil {
+			close(queue)
+		}
+	}
+	wp.submitMux.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
 		wp.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		// keyed work whose runner could not be scheduled before closing
+		return wp.takeKeyedPending(), nil
+	case <-ctx.Done():
+	}
+
+	close(wp.abortChan)
+	wp.dequeueMux.Lock()
+	defer wp.dequeueMux.Unlock()
+
+	wp.mux.Lock()
+	pending := wp.handedBack
+	wp.handedBack = nil
+	wp.mux.Unlock()
+	for _, queue := range wp.queues {
+		if queue == nil {
+			continue
+		}
+		for work := range queue {
+			pending = append(pending, work)
+		}
+	}
+	for _, work := range pending {
+		if _, ok := work.(*keyedRunner); !ok {
+			unprocessed = append(unprocessed, work)
+		}
+	}
+	unprocessed = append(unprocessed, wp.takeKeyedPending()...)
+	return unprocessed, fmt.Errorf("shutdown deadline reached, %d work unprocessed: %w", len(unprocessed), ctx.Err())
+}
+
+// Close waits for all queued work to finish. Keyed work that could no longer be scheduled once the pool was
+// closing is dropped and logged, use Shutdown to get it back.
+func (wp *workerPoolImpl) Close() {
+	unprocessed, _ := wp.Shutdown(context.Background())
+	if len(unprocessed) > 0 {
+		log.Warn("worker pool closed, unprocessed keyed work dropped", log.Int("count", len(unprocessed)))
 	}
 }
@@ -0,0 +1,422 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/util"
+	"github.com/gw-gong/gwkit-go/util/trace"
+)
+
+type funcWorkForTest func()
+
+func (f funcWorkForTest) Do() {
+	f()
+}
+
+func TestSubmitFuncReturnsResultAndPanic(t *testing.T) {
+	wp, _ := NewWorkerPool(10, 2)
+	defer wp.Close()
+
+	future, err := SubmitFunc(context.Background(), wp, func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+	if err != nil {
+		t.Fatalf("Expected submit to succeed, got %v", err)
+	}
+	if value, err := future.Wait(context.Background()); value != 42 || err != nil {
+		t.Errorf("Expected (42, nil), got (%d, %v)", value, err)
+	}
+
+	future, _ = SubmitFunc(context.Background(), wp, func(ctx context.Context) (int, error) {
+		panic("boom")
+	})
+	var panicErr *util.PanicError
+	if _, err := future.Wait(context.Background()); !errors.As(err, &panicErr) {
+		t.Errorf("Expected *util.PanicError, got %v", err)
+	}
+}
+
+func TestSubmittedFuncsKeepTraceAndSkipDoneCtx(t *testing.T) {
+	wp, _ := NewWorkerPool(10, 2)
+	defer wp.Close()
+
+	ctx := trace.SetTraceIDToCtx(trace.SetRequestIDToCtx(context.Background(), "rid-1"), "tid-1")
+	ctx, cancel := context.WithCancel(ctx)
+
+	traceCh := make(chan string, 1)
+	_ = wp.SubmitCtxFunc(ctx, func(ctx context.Context) {
+		traceCh <- trace.GetRequestIDFromCtx(ctx) + "/" + trace.GetTraceIDFromCtx(ctx)
+	})
+	if got := <-traceCh; got != "rid-1/tid-1" {
+		t.Errorf("Expected rid-1/tid-1 in SubmitCtxFunc, got %s", got)
+	}
+
+	future, _ := SubmitFunc(ctx, wp, func(ctx context.Context) (string, error) {
+		return trace.GetRequestIDFromCtx(ctx) + "/" + trace.GetTraceIDFromCtx(ctx), nil
+	})
+	if got, _ := future.Wait(context.Background()); got != "rid-1/tid-1" {
+		t.Errorf("Expected rid-1/tid-1 in SubmitFunc, got %s", got)
+	}
+
+	// hold both workers, so the next works are still queued when ctx is cancelled
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	for i := 0; i < 2; i++ {
+		_ = wp.Submit(funcWorkForTest(func() {
+			started <- struct{}{}
+			<-release
+		}))
+	}
+	<-started
+	<-started
+
+	var ran atomic.Bool
+	_ = wp.SubmitCtxFunc(ctx, func(ctx context.Context) { ran.Store(true) })
+	future, _ = SubmitFunc(ctx, wp, func(ctx context.Context) (string, error) {
+		ran.Store(true)
+		return "", nil
+	})
+	cancel()
+	close(release)
+
+	if _, err := future.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled for the skipped func, got %v", err)
+	}
+	waitFor(t, time.Second, func() bool { return wp.QueueLength() == 0 }, "Expected the queue to drain")
+	if ran.Load() {
+		t.Errorf("Expected funcs submitted with a cancelled ctx to be skipped")
+	}
+}
+
+func TestSubmittedFuncsKeepDeadline(t *testing.T) {
+	wp, _ := NewWorkerPool(10, 2)
+	defer wp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errCh := make(chan error, 1)
+	_ = wp.SubmitCtxFunc(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		errCh <- ctx.Err()
+	})
+	future, _ := SubmitFunc(ctx, wp, func(ctx context.Context) (struct{}, error) {
+		<-ctx.Done()
+		return struct{}{}, ctx.Err()
+	})
+
+	for _, wait := range []func() error{
+		func() error {
+			select {
+			case err := <-errCh:
+				return err
+			case <-time.After(time.Second):
+				return nil
+			}
+		},
+		func() error {
+			// cancelled instead of timed out, so that a hanging func does not look like a deadline
+			waitCtx, waitCancel := context.WithCancel(context.Background())
+			defer time.AfterFunc(time.Second, waitCancel).Stop()
+			_, err := future.Wait(waitCtx)
+			return err
+		},
+	} {
+		if err := wait(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the func to stop at the deadline of the caller, got %v", err)
+		}
+	}
+}
+
+// basicPool implements only WorkerPool, it must not need the methods of ManagedWorkerPool.
+type basicPool struct{}
+
+func (basicPool) Submit(work Work) error { return nil }
+func (basicPool) QueueLength() int       { return 0 }
+func (basicPool) Close()                 {}
+
+var _ WorkerPool = basicPool{}
+
+func TestSubmitCtxStopsWaitingWhenCtxIsDone(t *testing.T) {
+	wp, _ := NewWorkerPool(1, 1)
+	defer wp.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	_ = wp.Submit(funcWorkForTest(func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	if err := wp.SubmitCtx(context.Background(), funcWorkForTest(func() {})); err != nil {
+		t.Fatalf("Expected the work to be queued, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := wp.SubmitCtx(ctx, funcWorkForTest(func() {})); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded on a full queue, got %v", err)
+	}
+}
+
+// waitFor polls cond until it holds or the deadline passes, sleeps alone are flaky under -race or load.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElasticPoolGrowsAndShrinks(t *testing.T) {
+	wp, _ := NewWorkerPool(100, 8, WithMinWorkers(2), WithIdleTimeout(50*time.Millisecond))
+	defer wp.Close()
+
+	if n := wp.WorkerCount(); n != 2 {
+		t.Fatalf("Expected 2 workers at start, got %d", n)
+	}
+	release := make(chan struct{})
+	for i := 0; i < 40; i++ {
+		_ = wp.Submit(funcWorkForTest(func() { <-release }))
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		stats := wp.Stats()
+		return stats.Workers == 8 && stats.Running == 8 && stats.Queued == 32
+	}, "Expected the pool to grow to 8 running workers under load")
+	close(release)
+
+	waitFor(t, 5*time.Second, func() bool { return wp.WorkerCount() == 2 },
+		"Expected the pool to shrink back to 2 workers")
+	waitFor(t, time.Second, func() bool { return wp.Stats().Completed == 40 },
+		"Expected all 40 works to complete")
+
+	_ = wp.Resize(1)
+	waitFor(t, 2*time.Second, func() bool { return wp.WorkerCount() == 1 },
+		"Expected 1 worker after Resize(1)")
+}
+
+func TestResizeKeepsMinWorkers(t *testing.T) {
+	wp, _ := NewWorkerPool(100, 8, WithMinWorkers(2), WithIdleTimeout(50*time.Millisecond))
+	defer wp.Close()
+
+	_ = wp.Resize(1)
+	waitFor(t, 2*time.Second, func() bool { return wp.WorkerCount() == 1 }, "Expected 1 worker after Resize(1)")
+
+	_ = wp.Resize(8)
+	if n := wp.WorkerCount(); n != 2 {
+		t.Fatalf("Expected the configured 2 min workers after Resize(8), got %d", n)
+	}
+	release := make(chan struct{})
+	for i := 0; i < 40; i++ {
+		_ = wp.Submit(funcWorkForTest(func() { <-release }))
+	}
+	waitFor(t, 2*time.Second, func() bool { return wp.WorkerCount() == 8 }, "Expected the pool to grow again under load")
+	close(release)
+	waitFor(t, 5*time.Second, func() bool { return wp.WorkerCount() == 2 }, "Expected the pool to shrink back to 2 workers")
+}
+
+func TestResizeShrinksIdleFixedPool(t *testing.T) {
+	wp, _ := NewWorkerPool(10, 8)
+	defer wp.Close()
+
+	// every worker is idle, none of them gets work to notice the new max
+	_ = wp.Resize(2)
+	waitFor(t, time.Second, func() bool { return wp.WorkerCount() == 2 }, "Expected the idle pool to shrink to 2 workers")
+	_ = wp.Resize(4)
+	if n := wp.WorkerCount(); n != 4 {
+		t.Errorf("Expected 4 workers after Resize(4), got %d", n)
+	}
+}
+
+func TestShutdownReturnsUnprocessedWork(t *testing.T) {
+	wp, _ := NewWorkerPool(100, 2)
+
+	var done atomic.Int32
+	for i := 0; i < 20; i++ {
+		_ = wp.Submit(funcWorkForTest(func() {
+			time.Sleep(50 * time.Millisecond)
+			done.Add(1)
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	unprocessed, err := wp.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if err := wp.Submit(funcWorkForTest(func() {})); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed after shutdown, got %v", err)
+	}
+
+	waitFor(t, 2*time.Second, func() bool { return wp.Stats().Running == 0 }, "Expected the running work to finish")
+	if total := int(done.Load()) + len(unprocessed); total != 20 {
+		t.Errorf("Expected done + unprocessed = 20, got %d + %d", done.Load(), len(unprocessed))
+	}
+	if stats := wp.Stats(); stats.Completed != uint64(done.Load()) {
+		t.Errorf("Expected completed %d, got %d", done.Load(), stats.Completed)
+	}
+}
+
+func TestPriorityQueues(t *testing.T) {
+	wp, _ := NewWorkerPool(100, 1, WithPriorityQueues(4))
+	defer wp.Close()
+
+	block := make(chan struct{})
+	_ = wp.Submit(funcWorkForTest(func() { <-block }))
+	time.Sleep(10 * time.Millisecond) // the only worker is now blocked
+
+	var mux sync.Mutex
+	var order []Priority
+	record := func(p Priority) Work {
+		return funcWorkForTest(func() {
+			mux.Lock()
+			order = append(order, p)
+			mux.Unlock()
+		})
+	}
+	for i := 0; i < 4; i++ {
+		_ = wp.SubmitPriority(context.Background(), PriorityLow, record(PriorityLow))
+	}
+	for i := 0; i < 8; i++ {
+		_ = wp.SubmitPriority(context.Background(), PriorityHigh, record(PriorityHigh))
+	}
+	close(block)
+
+	deadline := time.Now().Add(time.Second)
+	for wp.Stats().Completed < 13 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if len(order) != 12 {
+		t.Fatalf("Expected 12 work done, got %d", len(order))
+	}
+	if order[0] != PriorityHigh {
+		t.Errorf("Expected high priority work first, got %v", order)
+	}
+	firstLow := -1
+	for i, p := range order {
+		if p == PriorityLow {
+			firstLow = i
+			break
+		}
+	}
+	if firstLow < 0 || firstLow >= 8 {
+		t.Errorf("Expected low priority work to run before all high priority work finished, got %v", order)
+	}
+}
+
+func TestKeyedWorkRunsInOrderPerKey(t *testing.T) {
+	wp, _ := NewWorkerPool(100, 4)
+	defer wp.Close()
+
+	var mux sync.Mutex
+	results := make(map[string][]int)
+	var running sync.Map
+	var overlapped atomic.Bool
+
+	for i := 0; i < 20; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			key, i := key, i
+			err := wp.SubmitKeyed(context.Background(), key, funcWorkForTest(func() {
+				if _, loaded := running.LoadOrStore(key, struct{}{}); loaded {
+					overlapped.Store(true)
+				}
+				time.Sleep(time.Millisecond)
+				mux.Lock()
+				results[key] = append(results[key], i)
+				mux.Unlock()
+				running.Delete(key)
+			}))
+			if err != nil {
+				t.Fatalf("Expected keyed submit to succeed, got %v", err)
+			}
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for wp.Stats().Completed < 60 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if overlapped.Load() {
+		t.Errorf("Expected work of the same key to never run concurrently")
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	for key, got := range results {
+		for i, v := range got {
+			if v != i {
+				t.Fatalf("Expected key %s to run in submission order, got %v", key, got)
+			}
+		}
+		if len(got) != 20 {
+			t.Errorf("Expected 20 work for key %s, got %d", key, len(got))
+		}
+	}
+}
+
+func TestShutdownReturnsPendingKeyedWork(t *testing.T) {
+	wp, _ := NewWorkerPool(100, 1)
+
+	for i := 0; i < 5; i++ {
+		_ = wp.SubmitKeyed(context.Background(), fmt.Sprintf("key-%d", i%2), funcWorkForTest(func() {
+			time.Sleep(50 * time.Millisecond)
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	unprocessed, _ := wp.Shutdown(ctx)
+	if len(unprocessed) != 4 {
+		t.Errorf("Expected 4 unprocessed keyed work, got %d", len(unprocessed))
+	}
+}
+
+func TestKeyedRunnerRetryStopsOnShutdown(t *testing.T) {
+	wp, _ := NewWorkerPool(2, 1)
+	baseline := runtime.NumGoroutine()
+
+	// block the worker and fill the queue, so no runner can be scheduled
+	release := make(chan struct{})
+	defer close(release)
+	_ = wp.Submit(funcWorkForTest(func() { <-release }))
+	waitFor(t, time.Second, func() bool { return wp.Stats().Running == 1 }, "Expected the worker to be busy")
+	_ = wp.Submit(funcWorkForTest(func() {}))
+	_ = wp.Submit(funcWorkForTest(func() {}))
+
+	// the first submit times out after the second one was accepted, its runner is retried in the background
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	firstErr := make(chan error, 1)
+	go func() {
+		firstErr <- wp.SubmitKeyed(ctx, "k", funcWorkForTest(func() {}))
+	}()
+	waitFor(t, time.Second, func() bool { return wp.Stats().Queued == 3 }, "Expected the first keyed work to be queued")
+	if err := wp.SubmitKeyed(context.Background(), "k", funcWorkForTest(func() {})); err != nil {
+		t.Fatalf("Expected the second keyed work to be accepted, got %v", err)
+	}
+	if err := <-firstErr; err == nil {
+		t.Fatalf("Expected the first keyed work to time out")
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer shutdownCancel()
+	unprocessed, _ := wp.Shutdown(shutdownCtx)
+	if len(unprocessed) != 3 {
+		t.Errorf("Expected the 2 queued work and the second keyed work unprocessed, got %d", len(unprocessed))
+	}
+	// only the blocked worker is left
+	waitFor(t, time.Second, func() bool { return runtime.NumGoroutine() <= baseline+1 },
+		"Expected the runner retry to stop on shutdown")
+}
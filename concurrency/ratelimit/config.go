@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmTokenBucket   Algorithm = "token_bucket"
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+)
+
+type Config struct {
+	Algorithm Algorithm `json:"algorithm" yaml:"algorithm" mapstructure:"algorithm"` // default AlgorithmTokenBucket
+
+	// token bucket: tokens added per second and bucket size, burst defaults to ceil(rate)
+	Rate  float64 `json:"rate" yaml:"rate" mapstructure:"rate"`
+	Burst int     `json:"burst" yaml:"burst" mapstructure:"burst"`
+
+	// sliding window log: at most Limit events in any WindowMs
+	Limit    int `json:"limit" yaml:"limit" mapstructure:"limit"`
+	WindowMs int `json:"window_ms" yaml:"window_ms" mapstructure:"window_ms"`
+}
+
+// normalize validates cfg and returns a copy with defaults applied.
+func normalize(cfg *Config) (*Config, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("rate limit config is nil")
+	}
+	c := *cfg
+	if c.Algorithm == "" {
+		c.Algorithm = AlgorithmTokenBucket
+	}
+	switch c.Algorithm {
+	case AlgorithmTokenBucket:
+		if c.Rate <= 0 {
+			return nil, fmt.Errorf("rate must be greater than 0, got %v", c.Rate)
+		}
+		if c.Burst <= 0 {
+			c.Burst = int(math.Ceil(c.Rate))
+		}
+	case AlgorithmSlidingWindow:
+		if c.Limit <= 0 || c.WindowMs <= 0 {
+			return nil, fmt.Errorf("limit and window_ms must be greater than 0, got %d and %d", c.Limit, c.WindowMs)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm: %s", c.Algorithm)
+	}
+	return &c, nil
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultKeyedCapacity = 10000
+)
+
+// KeyedLimiter keeps one limiter per key (user id, client ip, ...) and evicts the least recently used keys
+// beyond capacity. An evicted key starts over with a fresh limiter.
+type KeyedLimiter struct {
+	now      func() time.Time
+	capacity int
+
+	mux      sync.Mutex
+	cfg      *Config
+	lru      *list.List // front is the most recently used
+	limiters map[string]*list.Element
+}
+
+type keyedEntry struct {
+	key     string
+	limiter Limiter
+}
+
+// NewKeyedLimiter creates a KeyedLimiter, capacity <= 0 means DefaultKeyedCapacity.
+func NewKeyedLimiter(cfg *Config, capacity int) (*KeyedLimiter, error) {
+	c, err := normalize(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if capacity <= 0 {
+		capacity = DefaultKeyedCapacity
+	}
+	return &KeyedLimiter{
+		now:      time.Now,
+		capacity: capacity,
+		cfg:      c,
+		lru:      list.New(),
+		limiters: make(map[string]*list.Element),
+	}, nil
+}
+
+func (kl *KeyedLimiter) get(key string) Limiter {
+	kl.mux.Lock()
+	defer kl.mux.Unlock()
+
+	if elem, ok := kl.limiters[key]; ok {
+		kl.lru.MoveToFront(elem)
+		return elem.Value.(*keyedEntry).limiter
+	}
+
+	var limiter Limiter
+	switch kl.cfg.Algorithm {
+	case AlgorithmSlidingWindow:
+		limiter = newSlidingWindow(kl.cfg, kl.now)
+	default:
+		limiter = newTokenBucket(kl.cfg, kl.now)
+	}
+	kl.limiters[key] = kl.lru.PushFront(&keyedEntry{key: key, limiter: limiter})
+	for kl.lru.Len() > kl.capacity {
+		oldest := kl.lru.Back()
+		kl.lru.Remove(oldest)
+		delete(kl.limiters, oldest.Value.(*keyedEntry).key)
+	}
+	return limiter
+}
+
+func (kl *KeyedLimiter) Allow(key string) bool {
+	return kl.get(key).Allow()
+}
+
+func (kl *KeyedLimiter) Wait(ctx context.Context, key string) error {
+	return kl.get(key).Wait(ctx)
+}
+
+func (kl *KeyedLimiter) Reserve(key string) *Reservation {
+	return kl.get(key).Reserve()
+}
+
+func (kl *KeyedLimiter) Len() int {
+	kl.mux.Lock()
+	defer kl.mux.Unlock()
+	return kl.lru.Len()
+}
+
+// Update applies cfg to all existing keys and to new keys, switching the algorithm drops all keys.
+func (kl *KeyedLimiter) Update(cfg *Config) error {
+	c, err := normalize(cfg)
+	if err != nil {
+		return err
+	}
+	kl.mux.Lock()
+	defer kl.mux.Unlock()
+
+	if c.Algorithm != kl.cfg.Algorithm {
+		kl.lru.Init()
+		kl.limiters = make(map[string]*list.Element)
+		kl.cfg = c
+		return nil
+	}
+	for elem := kl.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*keyedEntry)
+		if err := entry.limiter.Update(c); err != nil {
+			return fmt.Errorf("failed to update limiter of key %s: %w", entry.key, err)
+		}
+	}
+	kl.cfg = c
+	return nil
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrLimitExceeded = errors.New("rate limit exceeded")
+)
+
+type Limiter interface {
+	// Allow reports whether an event may happen now, and consumes it if so.
+	Allow() bool
+	// Wait blocks until an event may happen or ctx is done. It fails fast if the ctx deadline is too close.
+	Wait(ctx context.Context) error
+	// Reserve books an event and returns how long the caller must wait before acting on it.
+	Reserve() *Reservation
+	// Update applies a new config of the same algorithm, e.g. from a hotcfg reload.
+	Update(cfg *Config) error
+}
+
+func NewLimiter(cfg *Config) (Limiter, error) {
+	c, err := normalize(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Algorithm {
+	case AlgorithmSlidingWindow:
+		return newSlidingWindow(c, time.Now), nil
+	default:
+		return newTokenBucket(c, time.Now), nil
+	}
+}
+
+type Reservation struct {
+	ok        bool
+	timeToAct time.Time
+	now       func() time.Time
+	cancel    func()
+}
+
+// OK is false if the event can never be admitted, e.g. the burst is smaller than the request.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return time.Duration(1<<63 - 1)
+	}
+	if delay := r.timeToAct.Sub(r.now()); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Cancel gives the reserved event back to the limiter if it has not been acted on yet.
+func (r *Reservation) Cancel() {
+	if r.ok && r.cancel != nil && r.timeToAct.After(r.now()) {
+		r.cancel()
+	}
+	r.cancel = nil
+}
+
+func wait(ctx context.Context, l Limiter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r := l.Reserve()
+	if !r.OK() {
+		return ErrLimitExceeded
+	}
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		r.Cancel()
+		return fmt.Errorf("wait %v would exceed context deadline: %w", delay, ErrLimitExceeded)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
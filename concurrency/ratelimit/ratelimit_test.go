@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := newFakeClock()
+	cfg, _ := normalize(&Config{Rate: 10, Burst: 5})
+	tb := newTokenBucket(cfg, clock.Now)
+
+	for i := 0; i < 5; i++ {
+		if !tb.Allow() {
+			t.Fatalf("Expected burst of 5 to be allowed, failed at %d", i)
+		}
+	}
+	if tb.Allow() {
+		t.Errorf("Expected the 6th event to be rejected")
+	}
+
+	clock.Add(100 * time.Millisecond)
+	if !tb.Allow() {
+		t.Errorf("Expected 1 token after 100ms at 10/s")
+	}
+
+	r := tb.Reserve()
+	if !r.OK() || r.Delay() != 100*time.Millisecond {
+		t.Errorf("Expected reservation delay 100ms, got %v", r.Delay())
+	}
+	r.Cancel()
+	clock.Add(100 * time.Millisecond)
+	if !tb.Allow() {
+		t.Errorf("Expected the cancelled reservation to give its token back")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := newFakeClock()
+	cfg, _ := normalize(&Config{Algorithm: AlgorithmSlidingWindow, Limit: 3, WindowMs: 1000})
+	sw := newSlidingWindow(cfg, clock.Now)
+
+	for i := 0; i < 3; i++ {
+		if !sw.Allow() {
+			t.Fatalf("Expected 3 events to be allowed, failed at %d", i)
+		}
+		clock.Add(100 * time.Millisecond)
+	}
+	if sw.Allow() {
+		t.Errorf("Expected the 4th event in the window to be rejected")
+	}
+
+	r := sw.Reserve()
+	if r.Delay() != 700*time.Millisecond {
+		t.Errorf("Expected the reservation to wait for the first event to leave the window, got %v", r.Delay())
+	}
+
+	clock.Add(700 * time.Millisecond)
+	if sw.Allow() {
+		t.Errorf("Expected the reserved slot to be taken")
+	}
+	clock.Add(100 * time.Millisecond)
+	if !sw.Allow() {
+		t.Errorf("Expected the second event to have left the window")
+	}
+}
+
+func TestWaitFailsFastOnDeadline(t *testing.T) {
+	l, _ := NewLimiter(&Config{Rate: 1, Burst: 1})
+	_ = l.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestKeyedLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	kl, _ := NewKeyedLimiter(&Config{Rate: 1, Burst: 1}, 2)
+	kl.now = newFakeClock().Now
+
+	kl.Allow("a")
+	kl.Allow("b")
+	kl.Allow("a")
+	kl.Allow("c") // evicts b
+	if kl.Len() != 2 {
+		t.Fatalf("Expected 2 keys, got %d", kl.Len())
+	}
+	if kl.Allow("a") {
+		t.Errorf("Expected key a to be kept and limited")
+	}
+	if !kl.Allow("b") {
+		t.Errorf("Expected evicted key b to start over")
+	}
+
+	if err := kl.Update(&Config{Rate: 1, Burst: 3}); err != nil {
+		t.Fatalf("Expected update to succeed, got %v", err)
+	}
+	if err := kl.Update(&Config{Rate: 0}); err == nil {
+		t.Errorf("Expected invalid config to be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// slidingWindow keeps the admitted (and reserved) event times, so the limit holds in any window, not only aligned ones.
+// Memory is O(limit).
+type slidingWindow struct {
+	now func() time.Time
+
+	mux    sync.Mutex
+	limit  int
+	window time.Duration
+	log    []time.Time // ascending
+}
+
+func newSlidingWindow(cfg *Config, now func() time.Time) *slidingWindow {
+	return &slidingWindow{
+		now:    now,
+		limit:  cfg.Limit,
+		window: time.Duration(cfg.WindowMs) * time.Millisecond,
+		log:    make([]time.Time, 0, cfg.Limit),
+	}
+}
+
+func (sw *slidingWindow) pruneLocked(now time.Time) {
+	expired := 0
+	for expired < len(sw.log) && !sw.log[expired].After(now.Add(-sw.window)) {
+		expired++
+	}
+	if expired > 0 {
+		sw.log = append(sw.log[:0], sw.log[expired:]...)
+	}
+}
+
+func (sw *slidingWindow) Allow() bool {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+	now := sw.now()
+	sw.pruneLocked(now)
+	if len(sw.log) >= sw.limit {
+		return false
+	}
+	sw.log = append(sw.log, now)
+	return true
+}
+
+func (sw *slidingWindow) Reserve() *Reservation {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+
+	now := sw.now()
+	sw.pruneLocked(now)
+	timeToAct := now
+	if len(sw.log) >= sw.limit {
+		// the event acts when the limit-th newest event leaves the window
+		timeToAct = sw.log[len(sw.log)-sw.limit].Add(sw.window)
+	}
+	sw.log = append(sw.log, timeToAct)
+	return &Reservation{
+		ok:        true,
+		timeToAct: timeToAct,
+		now:       sw.now,
+		cancel: func() {
+			sw.mux.Lock()
+			defer sw.mux.Unlock()
+			for i := len(sw.log) - 1; i >= 0; i-- {
+				if sw.log[i].Equal(timeToAct) {
+					sw.log = append(sw.log[:i], sw.log[i+1:]...)
+					return
+				}
+			}
+		},
+	}
+}
+
+func (sw *slidingWindow) Wait(ctx context.Context) error {
+	return wait(ctx, sw)
+}
+
+func (sw *slidingWindow) Update(cfg *Config) error {
+	c, err := normalize(cfg)
+	if err != nil {
+		return err
+	}
+	if c.Algorithm != AlgorithmSlidingWindow {
+		return fmt.Errorf("cannot change algorithm from %s to %s", AlgorithmSlidingWindow, c.Algorithm)
+	}
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+	sw.limit = c.Limit
+	sw.window = time.Duration(c.WindowMs) * time.Millisecond
+	return nil
+}
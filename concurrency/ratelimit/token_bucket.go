@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	now func() time.Time
+
+	mux    sync.Mutex
+	rate   float64 // tokens per second
+	burst  int
+	tokens float64 // may go negative for reservations in the future
+	last   time.Time
+}
+
+func newTokenBucket(cfg *Config, now func() time.Time) *tokenBucket {
+	return &tokenBucket{
+		now:    now,
+		rate:   cfg.Rate,
+		burst:  cfg.Burst,
+		tokens: float64(cfg.Burst),
+		last:   now(),
+	}
+}
+
+func (tb *tokenBucket) advanceLocked(now time.Time) {
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens += elapsed.Seconds() * tb.rate
+		if tb.tokens > float64(tb.burst) {
+			tb.tokens = float64(tb.burst)
+		}
+		tb.last = now
+	}
+}
+
+func (tb *tokenBucket) Allow() bool {
+	tb.mux.Lock()
+	defer tb.mux.Unlock()
+	tb.advanceLocked(tb.now())
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+func (tb *tokenBucket) Reserve() *Reservation {
+	tb.mux.Lock()
+	defer tb.mux.Unlock()
+
+	now := tb.now()
+	tb.advanceLocked(now)
+	if tb.burst < 1 {
+		return &Reservation{ok: false, now: tb.now}
+	}
+	tb.tokens--
+	timeToAct := now
+	if tb.tokens < 0 {
+		timeToAct = now.Add(time.Duration(-tb.tokens / tb.rate * float64(time.Second)))
+	}
+	return &Reservation{
+		ok:        true,
+		timeToAct: timeToAct,
+		now:       tb.now,
+		cancel: func() {
+			tb.mux.Lock()
+			defer tb.mux.Unlock()
+			tb.advanceLocked(tb.now())
+			tb.tokens++
+			if tb.tokens > float64(tb.burst) {
+				tb.tokens = float64(tb.burst)
+			}
+		},
+	}
+}
+
+func (tb *tokenBucket) Wait(ctx context.Context) error {
+	return wait(ctx, tb)
+}
+
+func (tb *tokenBucket) Update(cfg *Config) error {
+	c, err := normalize(cfg)
+	if err != nil {
+		return err
+	}
+	if c.Algorithm != AlgorithmTokenBucket {
+		return fmt.Errorf("cannot change algorithm from %s to %s", AlgorithmTokenBucket, c.Algorithm)
+	}
+	tb.mux.Lock()
+	defer tb.mux.Unlock()
+	tb.advanceLocked(tb.now())
+	tb.rate = c.Rate
+	tb.burst = c.Burst
+	if tb.tokens > float64(tb.burst) {
+		tb.tokens = float64(tb.burst)
+	}
+	return nil
+}
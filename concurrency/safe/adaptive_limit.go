@@ -0,0 +1,364 @@
+package safe
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type AdaptiveAlgorithm string
+
+const (
+	AdaptiveAlgorithmAIMD     AdaptiveAlgorithm = "aimd"
+	AdaptiveAlgorithmGradient AdaptiveAlgorithm = "gradient"
+)
+
+// AdaptiveLimitConfig enables the adaptive mode of AsyncFuncLimiter, the limit moves between MinLimit and
+// AsyncFuncLimiterConfig.MaxConcurrent according to the latency and errors of the functions it runs.
+type AdaptiveLimitConfig struct {
+	Algorithm    AdaptiveAlgorithm `json:"algorithm" yaml:"algorithm" mapstructure:"algorithm"` // default AdaptiveAlgorithmAIMD
+	InitialLimit int               `json:"initial_limit" yaml:"initial_limit" mapstructure:"initial_limit"`
+	MinLimit     int               `json:"min_limit" yaml:"min_limit" mapstructure:"min_limit"`
+
+	// aimd: the limit grows by 1 per successful call and is multiplied by BackoffRatio on an error
+	// or on a call slower than SlowCallMs (0 disables the latency check)
+	BackoffRatio float64 `json:"backoff_ratio" yaml:"backoff_ratio" mapstructure:"backoff_ratio"`
+	SlowCallMs   int     `json:"slow_call_ms" yaml:"slow_call_ms" mapstructure:"slow_call_ms"`
+
+	// gradient: the limit follows longRtt/shortRtt, Tolerance is how much the latency may grow before the limit shrinks,
+	// Smoothing is the weight of a new limit estimate
+	Tolerance float64 `json:"tolerance" yaml:"tolerance" mapstructure:"tolerance"`
+	Smoothing float64 `json:"smoothing" yaml:"smoothing" mapstructure:"smoothing"`
+}
+
+const (
+	defaultAdaptiveInitialLimit = 20
+	defaultAdaptiveMinLimit     = 1
+	defaultAdaptiveBackoffRatio = 0.9
+	defaultAdaptiveTolerance    = 2.0
+	defaultAdaptiveSmoothing    = 0.2
+
+	gradientLongRttAlpha = 0.01 // ewma weight of the long term rtt, about the last 100 samples
+)
+
+var (
+	errWaitTimeout       = errors.New("wait timeout")
+	errSemaphoreReplaced = errors.New("semaphore replaced")
+)
+
+// semaphore bounds the number of running functions, release reports the latency and the result of the function,
+// cancel gives back a slot that was not used. acquire gives up with errSemaphoreReplaced once replaced is closed.
+// A semaphore that replaces another one starts with the functions still running on it as carried slots,
+// releaseCarried gives back one of them when such a function is done.
+type semaphore interface {
+	tryAcquire() bool
+	acquire(ctx context.Context, timer <-chan time.Time, replaced <-chan struct{}) error
+	release(rtt time.Duration, failed bool)
+	cancel()
+	releaseCarried()
+	limit() int
+	inFlight() int
+}
+
+func newSemaphore(cfg *AsyncFuncLimiterConfig, carried int) semaphore {
+	if cfg.Adaptive != nil {
+		return newAdaptiveSemaphore(newAdaptiveLimit(cfg.Adaptive, cfg.MaxConcurrent), carried)
+	}
+	return newFixedSemaphore(cfg.MaxConcurrent, carried)
+}
+
+type fixedSemaphore struct {
+	semChan chan struct{}
+	carried atomic.Int64
+}
+
+func newFixedSemaphore(maxConcurrent, carried int) *fixedSemaphore {
+	s := &fixedSemaphore{semChan: make(chan struct{}, maxConcurrent)}
+	carried = min(carried, maxConcurrent)
+	for i := 0; i < carried; i++ {
+		s.semChan <- struct{}{}
+	}
+	s.carried.Store(int64(carried))
+	return s
+}
+
+func (s *fixedSemaphore) tryAcquire() bool {
+	select {
+	case s.semChan <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *fixedSemaphore) acquire(ctx context.Context, timer <-chan time.Time, replaced <-chan struct{}) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer:
+		return errWaitTimeout
+	case <-replaced:
+		return errSemaphoreReplaced
+	case s.semChan <- struct{}{}:
+		return nil
+	}
+}
+
+func (s *fixedSemaphore) release(time.Duration, bool) {
+	<-s.semChan
+}
+
+func (s *fixedSemaphore) cancel() {
+	<-s.semChan
+}
+
+func (s *fixedSemaphore) releaseCarried() {
+	for {
+		carried := s.carried.Load()
+		if carried <= 0 {
+			return
+		}
+		if s.carried.CompareAndSwap(carried, carried-1) {
+			<-s.semChan
+			return
+		}
+	}
+}
+
+func (s *fixedSemaphore) limit() int {
+	return cap(s.semChan)
+}
+
+func (s *fixedSemaphore) inFlight() int {
+	return len(s.semChan)
+}
+
+// limitAlgorithm computes the next limit from a finished call, it is called with the semaphore lock held.
+type limitAlgorithm interface {
+	update(rtt time.Duration, inFlight int, failed bool)
+	limit() int
+}
+
+// adaptiveSemaphore hands a freed slot to the longest waiting call, all waiters are only woken up when the
+// algorithm changes the limit.
+type adaptiveSemaphore struct {
+	mux       sync.Mutex
+	algorithm limitAlgorithm
+	running   int
+	carried   int
+	waiters   []chan struct{}
+}
+
+func newAdaptiveSemaphore(algorithm limitAlgorithm, carried int) *adaptiveSemaphore {
+	return &adaptiveSemaphore{algorithm: algorithm, running: carried, carried: carried}
+}
+
+func newAdaptiveLimit(cfg *AdaptiveLimitConfig, maxLimit int) limitAlgorithm {
+	c := *cfg
+	if c.MinLimit <= 0 {
+		c.MinLimit = defaultAdaptiveMinLimit
+	}
+	if c.MinLimit > maxLimit {
+		c.MinLimit = maxLimit
+	}
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = defaultAdaptiveInitialLimit
+	}
+	c.InitialLimit = clampLimit(float64(c.InitialLimit), c.MinLimit, maxLimit)
+
+	switch c.Algorithm {
+	case AdaptiveAlgorithmGradient:
+		if c.Tolerance < 1 {
+			c.Tolerance = defaultAdaptiveTolerance
+		}
+		if c.Smoothing <= 0 || c.Smoothing > 1 {
+			c.Smoothing = defaultAdaptiveSmoothing
+		}
+		return &gradientLimit{cfg: &c, maxLimit: maxLimit, current: float64(c.InitialLimit)}
+	default:
+		if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+			c.BackoffRatio = defaultAdaptiveBackoffRatio
+		}
+		return &aimdLimit{cfg: &c, maxLimit: maxLimit, current: c.InitialLimit}
+	}
+}
+
+func (s *adaptiveSemaphore) tryAcquire() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running < s.algorithm.limit() {
+		s.running++
+		return true
+	}
+	return false
+}
+
+func (s *adaptiveSemaphore) acquire(ctx context.Context, timer <-chan time.Time, replaced <-chan struct{}) error {
+	for {
+		s.mux.Lock()
+		if s.running < s.algorithm.limit() {
+			s.running++
+			s.mux.Unlock()
+			return nil
+		}
+		wake := make(chan struct{}, 1)
+		s.waiters = append(s.waiters, wake)
+		s.mux.Unlock()
+
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timer:
+			err = errWaitTimeout
+		case <-replaced:
+			err = errSemaphoreReplaced
+		case <-wake:
+			continue
+		}
+		s.removeWaiter(wake)
+		return err
+	}
+}
+
+// removeWaiter forgets a waiter that gave up, a wake up it got meanwhile is passed on to the next waiter.
+func (s *adaptiveSemaphore) removeWaiter(wake chan struct{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i, w := range s.waiters {
+		if w == wake {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return
+		}
+	}
+	s.wakeUpLocked()
+}
+
+func (s *adaptiveSemaphore) release(rtt time.Duration, failed bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	limit := s.algorithm.limit()
+	s.algorithm.update(rtt, s.running, failed)
+	s.running--
+	if s.algorithm.limit() != limit {
+		s.wakeUpAllLocked()
+		return
+	}
+	s.wakeUpLocked()
+}
+
+func (s *adaptiveSemaphore) cancel() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.running--
+	s.wakeUpLocked()
+}
+
+func (s *adaptiveSemaphore) releaseCarried() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.carried > 0 {
+		s.carried--
+		s.running--
+		s.wakeUpLocked()
+	}
+}
+
+// wakeUpLocked hands a free slot to the longest waiting call.
+func (s *adaptiveSemaphore) wakeUpLocked() {
+	if len(s.waiters) > 0 && s.running < s.algorithm.limit() {
+		s.waiters[0] <- struct{}{}
+		s.waiters[0] = nil
+		s.waiters = s.waiters[1:]
+	}
+}
+
+// wakeUpAllLocked lets every waiter re-check the limit after it changed.
+func (s *adaptiveSemaphore) wakeUpAllLocked() {
+	for _, wake := range s.waiters {
+		wake <- struct{}{}
+	}
+	s.waiters = nil
+}
+
+func (s *adaptiveSemaphore) limit() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.algorithm.limit()
+}
+
+func (s *adaptiveSemaphore) inFlight() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.running
+}
+
+// aimdLimit is additive increase / multiplicative decrease, like tcp congestion control.
+type aimdLimit struct {
+	cfg      *AdaptiveLimitConfig
+	maxLimit int
+	current  int
+}
+
+func (a *aimdLimit) update(rtt time.Duration, inFlight int, failed bool) {
+	if failed || (a.cfg.SlowCallMs > 0 && rtt >= time.Duration(a.cfg.SlowCallMs)*time.Millisecond) {
+		a.current = clampLimit(float64(a.current)*a.cfg.BackoffRatio, a.cfg.MinLimit, a.maxLimit)
+		return
+	}
+	// only grow when the limit is actually used, otherwise an idle limiter grows without bound
+	if inFlight*2 >= a.current {
+		a.current = clampLimit(float64(a.current+1), a.cfg.MinLimit, a.maxLimit)
+	}
+}
+
+func (a *aimdLimit) limit() int {
+	return a.current
+}
+
+// gradientLimit compares the latency of each call with the long term average latency, the limit shrinks
+// when calls get slower (queueing in the downstream) and grows by about sqrt(limit) while they don't.
+type gradientLimit struct {
+	cfg      *AdaptiveLimitConfig
+	maxLimit int
+	current  float64
+	longRtt  float64
+}
+
+func (g *gradientLimit) update(rtt time.Duration, inFlight int, failed bool) {
+	shortRtt := float64(rtt)
+	if shortRtt <= 0 {
+		shortRtt = 1
+	}
+	if g.longRtt == 0 {
+		g.longRtt = shortRtt
+	}
+	g.longRtt = g.longRtt*(1-gradientLongRttAlpha) + shortRtt*gradientLongRttAlpha
+	// recover faster once the latency is back to normal after a long slow period
+	if g.longRtt/shortRtt > 2 {
+		g.longRtt *= 0.95
+	}
+
+	if !failed && float64(inFlight) < g.current/2 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, g.cfg.Tolerance*g.longRtt/shortRtt))
+	estimate := g.current*gradient + math.Sqrt(g.current)
+	if failed {
+		// no sqrt growth on failure, at small limits it would outweigh the halving and raise the limit
+		estimate = g.current * 0.5
+	}
+	estimate = g.current*(1-g.cfg.Smoothing) + estimate*g.cfg.Smoothing
+	g.current = math.Max(float64(g.cfg.MinLimit), math.Min(float64(g.maxLimit), estimate))
+}
+
+func (g *gradientLimit) limit() int {
+	return int(g.current)
+}
+
+func clampLimit(limit float64, minLimit, maxLimit int) int {
+	return int(math.Max(float64(minLimit), math.Min(float64(maxLimit), limit)))
+}
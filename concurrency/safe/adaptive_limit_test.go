@@ -0,0 +1,98 @@
+package safe
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAIMDLimit(t *testing.T) {
+	aimd := newAdaptiveLimit(&AdaptiveLimitConfig{InitialLimit: 10, MinLimit: 2, SlowCallMs: 100}, 12).(*aimdLimit)
+
+	aimd.update(10*time.Millisecond, 2, false)
+	if aimd.limit() != 10 {
+		t.Errorf("Expected no growth while the limit is mostly unused, got %d", aimd.limit())
+	}
+	for i := 0; i < 5; i++ {
+		aimd.update(10*time.Millisecond, 10, false)
+	}
+	if aimd.limit() != 12 {
+		t.Errorf("Expected the limit to grow up to the max 12, got %d", aimd.limit())
+	}
+
+	aimd.update(10*time.Millisecond, 10, true)
+	if aimd.limit() != 10 {
+		t.Errorf("Expected 12*0.9 on error, got %d", aimd.limit())
+	}
+	aimd.update(200*time.Millisecond, 10, false)
+	if aimd.limit() != 9 {
+		t.Errorf("Expected 10*0.9 on a slow call, got %d", aimd.limit())
+	}
+	for i := 0; i < 50; i++ {
+		aimd.update(0, 10, true)
+	}
+	if aimd.limit() != 2 {
+		t.Errorf("Expected the limit to stop at the min 2, got %d", aimd.limit())
+	}
+}
+
+func TestGradientLimitShrinksWhenLatencyGrows(t *testing.T) {
+	gradient := newAdaptiveLimit(&AdaptiveLimitConfig{Algorithm: AdaptiveAlgorithmGradient, InitialLimit: 50}, 100).(*gradientLimit)
+
+	for i := 0; i < 100; i++ {
+		gradient.update(10*time.Millisecond, gradient.limit(), false)
+	}
+	grown := gradient.limit()
+	if grown <= 50 {
+		t.Fatalf("Expected the limit to grow under a stable latency, got %d", grown)
+	}
+	for i := 0; i < 20; i++ {
+		gradient.update(100*time.Millisecond, gradient.limit(), false)
+	}
+	if gradient.limit() >= grown {
+		t.Errorf("Expected the limit to shrink when the latency grows, got %d >= %d", gradient.limit(), grown)
+	}
+}
+
+func TestGradientLimitNeverGrowsOnFailure(t *testing.T) {
+	for _, initial := range []int{1, 2, 4, 50} {
+		gradient := newAdaptiveLimit(&AdaptiveLimitConfig{Algorithm: AdaptiveAlgorithmGradient, InitialLimit: initial}, 100).(*gradientLimit)
+		for i := 0; i < 10; i++ {
+			before := gradient.current
+			gradient.update(10*time.Millisecond, gradient.limit(), true)
+			if gradient.current > before {
+				t.Errorf("Expected a failure not to raise the limit from %v, got %v", before, gradient.current)
+			}
+		}
+	}
+}
+
+func TestAdaptiveLimiterRejectsAboveLimit(t *testing.T) {
+	afl := NewAsyncFuncLimiter(&AsyncFuncLimiterConfig{
+		MaxConcurrent: 10,
+		WaitTimeoutMs: 20,
+		Adaptive:      &AdaptiveLimitConfig{InitialLimit: 2},
+	})
+	defer afl.Close()
+
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		if err := afl.Async(context.Background(), func() {
+			defer wg.Done()
+			<-block
+		}); err != nil {
+			t.Fatalf("Expected the first 2 calls to run, got %v", err)
+		}
+	}
+	if err := afl.Async(context.Background(), func() {}); err == nil {
+		t.Errorf("Expected the 3rd call to be rejected")
+	}
+	if stats := afl.Stats(); stats.Limit != 2 || stats.InFlight != 2 || stats.Rejected != 1 {
+		t.Errorf("Expected limit 2, in flight 2, rejected 1, got %+v", stats)
+	}
+	close(block)
+	wg.Wait()
+}
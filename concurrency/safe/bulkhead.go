@@ -0,0 +1,98 @@
+package safe
+
+import (
+	"sync"
+)
+
+// BulkheadRegistry holds one AsyncFuncLimiter per dependency, so a slow dependency only uses up its own
+// concurrency budget.
+type BulkheadRegistry struct {
+	defaultCfg *AsyncFuncLimiterConfig
+
+	mux       sync.RWMutex
+	bulkheads map[string]*AsyncFuncLimiter
+}
+
+// NewBulkheadRegistry creates a registry, defaultCfg is used for bulkheads that were not configured.
+func NewBulkheadRegistry(defaultCfg *AsyncFuncLimiterConfig) *BulkheadRegistry {
+	return &BulkheadRegistry{
+		defaultCfg: defaultCfg,
+		bulkheads:  make(map[string]*AsyncFuncLimiter),
+	}
+}
+
+// Get returns the bulkhead of name, creating it with the default config on first use.
+func (r *BulkheadRegistry) Get(name string) *AsyncFuncLimiter {
+	r.mux.RLock()
+	bulkhead, ok := r.bulkheads[name]
+	r.mux.RUnlock()
+	if ok {
+		return bulkhead
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if bulkhead, ok := r.bulkheads[name]; ok {
+		return bulkhead
+	}
+	bulkhead = NewAsyncFuncLimiter(copyLimiterConfig(r.defaultCfg))
+	r.bulkheads[name] = bulkhead
+	return bulkhead
+}
+
+// Configure creates the bulkhead of name, or updates it in place with AsyncFuncLimiter.UpdateConfig, e.g. on a
+// hotcfg reload. Running calls keep counting against the new limit and holders of the bulkhead keep using it.
+func (r *BulkheadRegistry) Configure(name string, cfg *AsyncFuncLimiterConfig) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if bulkhead, ok := r.bulkheads[name]; ok {
+		bulkhead.UpdateConfig(cfg)
+		return
+	}
+	r.bulkheads[name] = NewAsyncFuncLimiter(copyLimiterConfig(cfg))
+}
+
+func (r *BulkheadRegistry) Stats() map[string]AsyncFuncLimiterStats {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	stats := make(map[string]AsyncFuncLimiterStats, len(r.bulkheads))
+	for name, bulkhead := range r.bulkheads {
+		stats[name] = bulkhead.Stats()
+	}
+	return stats
+}
+
+func (r *BulkheadRegistry) Close() {
+	r.mux.Lock()
+	bulkheads := r.bulkheads
+	r.bulkheads = make(map[string]*AsyncFuncLimiter)
+	r.mux.Unlock()
+
+	for _, bulkhead := range bulkheads {
+		bulkhead.Close()
+	}
+}
+
+// copyLimiterConfig is needed because NewAsyncFuncLimiter fills in the defaults on the config it is given.
+func copyLimiterConfig(cfg *AsyncFuncLimiterConfig) *AsyncFuncLimiterConfig {
+	if cfg == nil {
+		return nil
+	}
+	c := *cfg
+	return &c
+}
+
+var defaultBulkheadRegistry = NewBulkheadRegistry(nil)
+
+// Bulkhead returns the named bulkhead of the default registry.
+func Bulkhead(name string) *AsyncFuncLimiter {
+	return defaultBulkheadRegistry.Get(name)
+}
+
+func ConfigureBulkhead(name string, cfg *AsyncFuncLimiterConfig) {
+	defaultBulkheadRegistry.Configure(name, cfg)
+}
+
+func BulkheadStats() map[string]AsyncFuncLimiterStats {
+	return defaultBulkheadRegistry.Stats()
+}
@@ -0,0 +1,101 @@
+package safe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDoRunsInlineUnderLimit(t *testing.T) {
+	afl := NewAsyncFuncLimiter(&AsyncFuncLimiterConfig{MaxConcurrent: 1, WaitTimeoutMs: 10})
+	defer afl.Close()
+
+	errFn := errors.New("fn failed")
+	err := afl.Do(context.Background(), func(ctx context.Context) error {
+		if inner := afl.Do(ctx, func(ctx context.Context) error { return nil }); inner == nil {
+			t.Errorf("Expected the nested call to be rejected while the only slot is taken")
+		}
+		return errFn
+	})
+	if !errors.Is(err, errFn) {
+		t.Errorf("Expected the error of fn, got %v", err)
+	}
+	if stats := afl.Stats(); stats.InFlight != 0 || stats.Rejected != 1 {
+		t.Errorf("Expected the slot to be released and 1 rejection, got %+v", stats)
+	}
+}
+
+func TestBulkheadRegistryIsolatesLimits(t *testing.T) {
+	r := NewBulkheadRegistry(&AsyncFuncLimiterConfig{MaxConcurrent: 5})
+	defer r.Close()
+	r.Configure("payments", &AsyncFuncLimiterConfig{MaxConcurrent: 1, WaitTimeoutMs: 10})
+
+	_ = r.Get("payments").Do(context.Background(), func(ctx context.Context) error {
+		if err := r.Get("payments").Do(ctx, func(ctx context.Context) error { return nil }); err == nil {
+			t.Errorf("Expected payments to be full")
+		}
+		if err := r.Get("search").Do(ctx, func(ctx context.Context) error { return nil }); err != nil {
+			t.Errorf("Expected search to be unaffected by payments, got %v", err)
+		}
+		return nil
+	})
+
+	stats := r.Stats()
+	if stats["payments"].Limit != 1 || stats["payments"].Rejected != 1 {
+		t.Errorf("Expected payments limit 1 with 1 rejection, got %+v", stats["payments"])
+	}
+	if stats["search"].Limit != 5 || stats["search"].Rejected != 0 {
+		t.Errorf("Expected search limit 5 without rejection, got %+v", stats["search"])
+	}
+}
+
+func TestBulkheadConfigureWhileCallsInFlight(t *testing.T) {
+	r := NewBulkheadRegistry(nil)
+	defer r.Close()
+	r.Configure("payments", &AsyncFuncLimiterConfig{MaxConcurrent: 2, WaitTimeoutMs: 10})
+	bulkhead := r.Get("payments")
+
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	for i := 0; i < 2; i++ {
+		if err := bulkhead.Async(context.Background(), func() {
+			started <- struct{}{}
+			<-release
+		}); err != nil {
+			t.Fatalf("Expected the first 2 calls to run, got %v", err)
+		}
+	}
+	<-started
+	<-started
+
+	// the running calls keep their slots, so a limit of 3 leaves room for exactly one more call
+	r.Configure("payments", &AsyncFuncLimiterConfig{MaxConcurrent: 3, WaitTimeoutMs: 10})
+	err := bulkhead.Do(context.Background(), func(ctx context.Context) error {
+		if err := r.Get("payments").Do(ctx, func(ctx context.Context) error { return nil }); err == nil {
+			t.Errorf("Expected a 4th call to be rejected at limit 3")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected the kept bulkhead to accept a 3rd call, got %v", err)
+	}
+
+	// shrinking below the running calls rejects new calls until enough of them are done
+	r.Configure("payments", &AsyncFuncLimiterConfig{MaxConcurrent: 1, WaitTimeoutMs: 10})
+	if err := bulkhead.Do(context.Background(), func(ctx context.Context) error { return nil }); err == nil {
+		t.Errorf("Expected a call to be rejected while 2 calls run at limit 1")
+	}
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for bulkhead.Stats().InFlight > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := bulkhead.Do(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected a call to run once the running calls are done, got %v", err)
+	}
+
+	stats := r.Stats()["payments"]
+	if stats.Limit != 1 || stats.Rejected != 2 {
+		t.Errorf("Expected limit 1 and the rejections kept across reloads, got %+v", stats)
+	}
+}
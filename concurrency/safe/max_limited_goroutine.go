@@ -8,7 +8,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/gw-gong/gwkit-go/log"
 	"github.com/gw-gong/gwkit-go/util"
+	"github.com/gw-gong/gwkit-go/util/trace"
 )
 
 var (
@@ -19,6 +21,9 @@ var (
 type AsyncFuncLimiterConfig struct {
 	MaxConcurrent int `json:"max_concurrent" yaml:"max_concurrent" mapstructure:"max_concurrent"`
 	WaitTimeoutMs int `json:"wait_timeout_ms" yaml:"wait_timeout_ms" mapstructure:"wait_timeout_ms"`
+
+	// Adaptive enables the adaptive limit with MaxConcurrent as upper bound, nil keeps the fixed MaxConcurrent limit.
+	Adaptive *AdaptiveLimitConfig `json:"adaptive" yaml:"adaptive" mapstructure:"adaptive"`
 }
 
 const (
@@ -27,10 +32,24 @@ const (
 )
 
 type AsyncFuncLimiter struct {
-	semChan     chan struct{}
-	waitTimeout time.Duration
+	// semMux is held for reading while a slot is taken or given back, UpdateConfig takes it for writing
+	// to replace sem, so that every running function is either carried over or already released.
+	semMux      sync.RWMutex
+	sem         semaphore
+	semReplaced chan struct{} // closed by UpdateConfig before sem is replaced, stops the waiters of the old sem
+	waitTimeout atomic.Int64  // time.Duration
 	wg          sync.WaitGroup
 	closed      atomic.Bool
+	rejected    atomic.Uint64
+
+	cfgMux sync.Mutex
+	cfg    AsyncFuncLimiterConfig // normalized copy, compared by UpdateConfig
+}
+
+type AsyncFuncLimiterStats struct {
+	Limit    int    // current concurrency limit, changes over time in adaptive mode
+	InFlight int    // running functions
+	Rejected uint64 // calls rejected because the limit was reached, ctx cancellations are not counted
 }
 
 func NewAsyncFuncLimiter(cfg *AsyncFuncLimiterConfig) *AsyncFuncLimiter {
@@ -40,18 +59,66 @@ func NewAsyncFuncLimiter(cfg *AsyncFuncLimiterConfig) *AsyncFuncLimiter {
 			WaitTimeoutMs: defaultWaitTimeoutMs,
 		}
 	}
+	fillLimiterConfigDefaults(cfg)
+	afl := &AsyncFuncLimiter{
+		sem:         newSemaphore(cfg, 0),
+		semReplaced: make(chan struct{}),
+		wg:          sync.WaitGroup{},
+		closed:      atomic.Bool{},
+		cfg:         copyLimiterConfigValue(cfg),
+	}
+	afl.waitTimeout.Store(int64(time.Duration(cfg.WaitTimeoutMs) * time.Millisecond))
+	return afl
+}
+
+func fillLimiterConfigDefaults(cfg *AsyncFuncLimiterConfig) {
 	if cfg.MaxConcurrent <= 0 {
 		cfg.MaxConcurrent = defaultMaxConcurrent
 	}
 	if cfg.WaitTimeoutMs <= 0 {
 		cfg.WaitTimeoutMs = defaultWaitTimeoutMs
 	}
-	return &AsyncFuncLimiter{
-		semChan:     make(chan struct{}, cfg.MaxConcurrent),
-		waitTimeout: time.Duration(cfg.WaitTimeoutMs) * time.Millisecond,
-		wg:          sync.WaitGroup{},
-		closed:      atomic.Bool{},
+}
+
+// copyLimiterConfigValue also copies Adaptive, so that later changes of the caller's config are not seen.
+func copyLimiterConfigValue(cfg *AsyncFuncLimiterConfig) AsyncFuncLimiterConfig {
+	c := *cfg
+	if cfg.Adaptive != nil {
+		adaptive := *cfg.Adaptive
+		c.Adaptive = &adaptive
+	}
+	return c
+}
+
+// UpdateConfig applies a new config in place, e.g. from a hotcfg reload. Running functions keep their slots and
+// count against the new limit, the stats are kept, and the semaphore is only replaced if MaxConcurrent or Adaptive
+// changed, so an adaptive limit keeps what it learned across reloads of an unchanged config.
+// After a shrink, Stats().InFlight counts the running functions only up to the new limit.
+func (afl *AsyncFuncLimiter) UpdateConfig(cfg *AsyncFuncLimiterConfig) {
+	c := AsyncFuncLimiterConfig{}
+	if cfg != nil {
+		c = copyLimiterConfigValue(cfg)
+	}
+	fillLimiterConfigDefaults(&c)
+
+	afl.cfgMux.Lock()
+	defer afl.cfgMux.Unlock()
+	afl.waitTimeout.Store(int64(time.Duration(c.WaitTimeoutMs) * time.Millisecond))
+	if c.MaxConcurrent != afl.cfg.MaxConcurrent || !sameAdaptiveConfig(c.Adaptive, afl.cfg.Adaptive) {
+		close(afl.semReplaced)
+		afl.semMux.Lock()
+		afl.sem = newSemaphore(&c, afl.sem.inFlight())
+		afl.semReplaced = make(chan struct{})
+		afl.semMux.Unlock()
+	}
+	afl.cfg = c
+}
+
+func sameAdaptiveConfig(a, b *AdaptiveLimitConfig) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return *a == *b
 }
 
 func (afl *AsyncFuncLimiter) Close() {
@@ -59,54 +126,162 @@ func (afl *AsyncFuncLimiter) Close() {
 	afl.wg.Wait()
 }
 
-func (afl *AsyncFuncLimiter) Async(ctx context.Context, fn func()) error {
-	if afl.closed.Load() {
-		return ErrLimiterClosed
+func (afl *AsyncFuncLimiter) Stats() AsyncFuncLimiterStats {
+	afl.semMux.RLock()
+	defer afl.semMux.RUnlock()
+	return AsyncFuncLimiterStats{
+		Limit:    afl.sem.limit(),
+		InFlight: afl.sem.inFlight(),
+		Rejected: afl.rejected.Load(),
 	}
+}
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
+// AsyncCtx behaves like Async, fn runs with trace.CopyCtx(ctx), so logs and panics keep the rid/tid of the caller.
+func (afl *AsyncFuncLimiter) AsyncCtx(ctx context.Context, fn func(ctx context.Context)) error {
+	return afl.AsyncErr(ctx, func(ctx context.Context) error {
+		fn(ctx)
+		return nil
+	})
+}
 
-	case afl.semChan <- struct{}{}:
-		if afl.closed.Load() {
-			<-afl.semChan
-			return ErrLimiterClosed
+// AsyncErr behaves like AsyncCtx, the error of fn is logged and counts as a failure for the adaptive limit.
+func (afl *AsyncFuncLimiter) AsyncErr(ctx context.Context, fn func(ctx context.Context) error) error {
+	sem, err := afl.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	asyncCtx := trace.CopyCtx(ctx)
+	afl.executeAsync(sem, func() (err error) {
+		util.WithRecover(func() {
+			err = fn(asyncCtx)
+		}, func(panicErr interface{}) {
+			util.DefaultPanicWithCtx(asyncCtx, panicErr)
+			err = util.NewPanicError(panicErr)
+		})
+		if err != nil {
+			log.Warnc(asyncCtx, "async func failed", log.Err(err))
 		}
-		afl.executeAsync(fn)
+		return err
+	})
+	return nil
+}
+
+func (afl *AsyncFuncLimiter) Async(ctx context.Context, fn func()) error {
+	sem, err := afl.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	afl.executeAsync(sem, func() error {
+		fn()
 		return nil
+	})
+	return nil
+}
 
-	default:
-		if afl.waitTimeout == 0 {
-			return ErrNoWaitTimeout
-		}
+// Do runs fn inline under the same limit and wait timeout as Async, and returns its error.
+// A panic in fn is not recovered, it counts as a failure and propagates to the caller.
+func (afl *AsyncFuncLimiter) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	sem, err := afl.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	afl.wg.Add(1)
+	start := time.Now()
+	failed := true
+	defer func() {
+		afl.release(sem, time.Since(start), failed)
+		afl.wg.Done()
+	}()
+	err = fn(ctx)
+	failed = err != nil
+	return err
+}
 
-		timeout := time.NewTimer(afl.waitTimeout)
-		defer timeout.Stop()
-
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-timeout.C:
-			return fmt.Errorf("wait timeout(%v)", afl.waitTimeout)
-		case afl.semChan <- struct{}{}:
-			if afl.closed.Load() {
-				<-afl.semChan
-				return ErrLimiterClosed
-			}
-			afl.executeAsync(fn)
-			return nil
+// acquire returns the semaphore the slot was taken from, the slot must be given back with release.
+func (afl *AsyncFuncLimiter) acquire(ctx context.Context) (semaphore, error) {
+	if afl.closed.Load() {
+		return nil, ErrLimiterClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sem, err := afl.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if afl.closed.Load() {
+		afl.cancel(sem)
+		return nil, ErrLimiterClosed
+	}
+	return sem, nil
+}
+
+func (afl *AsyncFuncLimiter) acquireSlot(ctx context.Context) (semaphore, error) {
+	afl.semMux.RLock()
+	sem := afl.sem
+	ok := sem.tryAcquire()
+	afl.semMux.RUnlock()
+	if ok {
+		return sem, nil
+	}
+
+	waitTimeout := time.Duration(afl.waitTimeout.Load())
+	if waitTimeout == 0 {
+		afl.rejected.Add(1)
+		return nil, ErrNoWaitTimeout
+	}
+	timer := time.NewTimer(waitTimeout)
+	defer timer.Stop()
+	for {
+		afl.semMux.RLock()
+		sem, replaced := afl.sem, afl.semReplaced
+		err := sem.acquire(ctx, timer.C, replaced)
+		afl.semMux.RUnlock()
+		switch {
+		case err == nil:
+			return sem, nil
+		case errors.Is(err, errSemaphoreReplaced):
+			// retry on the new semaphore with the rest of the wait timeout
+		case errors.Is(err, errWaitTimeout):
+			afl.rejected.Add(1)
+			return nil, fmt.Errorf("wait timeout(%v)", waitTimeout)
+		default:
+			return nil, err
 		}
 	}
 }
 
-func (afl *AsyncFuncLimiter) executeAsync(fn func()) {
+// release gives back a slot of sem, a slot of a replaced semaphore also gives back its carried slot.
+func (afl *AsyncFuncLimiter) release(sem semaphore, rtt time.Duration, failed bool) {
+	afl.semMux.RLock()
+	defer afl.semMux.RUnlock()
+	sem.release(rtt, failed)
+	if afl.sem != sem {
+		afl.sem.releaseCarried()
+	}
+}
+
+// cancel is release for a slot that was not used.
+func (afl *AsyncFuncLimiter) cancel(sem semaphore) {
+	afl.semMux.RLock()
+	defer afl.semMux.RUnlock()
+	sem.cancel()
+	if afl.sem != sem {
+		afl.sem.releaseCarried()
+	}
+}
+
+// executeAsync runs fn in a new goroutine, a panic that escapes fn counts as a failure.
+func (afl *AsyncFuncLimiter) executeAsync(sem semaphore, fn func() error) {
 	afl.wg.Add(1)
 	go util.WithRecover(func() {
+		start := time.Now()
+		failed := true
 		defer func() {
-			<-afl.semChan
+			afl.release(sem, time.Since(start), failed)
 			afl.wg.Done()
 		}()
-		fn()
+		failed = fn() != nil
 	})
 }
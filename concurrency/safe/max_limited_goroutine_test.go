@@ -0,0 +1,122 @@
+package safe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/util/trace"
+)
+
+func TestAsyncCtxKeepsTraceAndSkipsDoneCtx(t *testing.T) {
+	afl := NewAsyncFuncLimiter(&AsyncFuncLimiterConfig{MaxConcurrent: 1, WaitTimeoutMs: 100})
+	defer afl.Close()
+
+	ctx := trace.SetTraceIDToCtx(trace.SetRequestIDToCtx(context.Background(), "rid-1"), "tid-1")
+	traceCh := make(chan string, 1)
+	if err := afl.AsyncCtx(ctx, func(ctx context.Context) {
+		traceCh <- trace.GetRequestIDFromCtx(ctx) + "/" + trace.GetTraceIDFromCtx(ctx)
+	}); err != nil {
+		t.Fatalf("Expected AsyncCtx to succeed, got %v", err)
+	}
+	if got := <-traceCh; got != "rid-1/tid-1" {
+		t.Errorf("Expected rid-1/tid-1 in the async func, got %s", got)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	ran := make(chan struct{}, 1)
+	if err := afl.AsyncCtx(cancelled, func(ctx context.Context) { ran <- struct{}{} }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled for a cancelled ctx, got %v", err)
+	}
+	select {
+	case <-ran:
+		t.Errorf("Expected the func not to run with a cancelled ctx")
+	default:
+	}
+}
+
+func TestFixedLimitUsesChannelSemaphore(t *testing.T) {
+	afl := NewAsyncFuncLimiter(&AsyncFuncLimiterConfig{MaxConcurrent: 3})
+	defer afl.Close()
+	if _, ok := afl.sem.(*fixedSemaphore); !ok {
+		t.Errorf("Expected the fixed limit to use the channel semaphore, got %T", afl.sem)
+	}
+}
+
+func TestAdaptiveReleaseWakesOneWaiter(t *testing.T) {
+	sem := newAdaptiveSemaphore(newAdaptiveLimit(&AdaptiveLimitConfig{InitialLimit: 1, MinLimit: 1}, 1), 0)
+	if !sem.tryAcquire() {
+		t.Fatalf("Expected the first slot to be free")
+	}
+
+	acquired := make(chan struct{}, 3)
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	for i := 0; i < 3; i++ {
+		go func() {
+			if sem.acquire(context.Background(), timer.C, nil) == nil {
+				acquired <- struct{}{}
+			}
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		sem.mux.Lock()
+		waiters := len(sem.waiters)
+		sem.mux.Unlock()
+		if waiters == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 waiters, got %d", waiters)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the limit stays at its max of 1, so the release hands the slot to one waiter only
+	sem.release(time.Millisecond, false)
+	<-acquired
+	sem.mux.Lock()
+	waiters := len(sem.waiters)
+	sem.mux.Unlock()
+	if waiters != 2 || sem.inFlight() != 1 {
+		t.Errorf("Expected 2 waiters left and 1 slot in use, got %d waiters and %d in use", waiters, sem.inFlight())
+	}
+}
+
+func TestUpdateConfigLetsWaitersIn(t *testing.T) {
+	afl := NewAsyncFuncLimiter(&AsyncFuncLimiterConfig{MaxConcurrent: 1, WaitTimeoutMs: 2000})
+	defer afl.Close()
+
+	release := make(chan struct{})
+	_ = afl.Async(context.Background(), func() { <-release })
+	waited := make(chan error, 1)
+	go func() {
+		waited <- afl.Do(context.Background(), func(ctx context.Context) error { return nil })
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	afl.UpdateConfig(&AsyncFuncLimiterConfig{MaxConcurrent: 2, WaitTimeoutMs: 2000})
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("Expected the waiting call to run after the limit grew, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the waiting call to move to the new limit")
+	}
+	if stats := afl.Stats(); stats.Limit != 2 || stats.InFlight != 1 {
+		t.Errorf("Expected limit 2 with the running call carried over, got %+v", stats)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for afl.Stats().InFlight > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the carried slot to be given back, got %+v", afl.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,328 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	ErrSchedulerStopped = errors.New("scheduler is stopped")
+	ErrDuplicateJob     = errors.New("job name already exists")
+)
+
+// OverlapPolicy decides what happens when a job is due while its previous run is still running.
+type OverlapPolicy int
+
+const (
+	OverlapSkip  OverlapPolicy = iota // drop the activation
+	OverlapQueue                      // run it after the current run, at most maxQueuedRuns are kept
+)
+
+const maxQueuedRuns = 16
+
+type JobFunc func(ctx context.Context) error
+
+type JobStatus struct {
+	Name         string        `json:"name"`
+	Schedule     string        `json:"schedule"`
+	Running      bool          `json:"running"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRun      time.Time     `json:"next_run"`
+	Runs         uint64        `json:"runs"`
+	Failures     uint64        `json:"failures"`
+	Skipped      uint64        `json:"skipped"`
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       JobFunc
+	jitter   time.Duration
+	timeout  time.Duration
+	overlap  OverlapPolicy
+	triggers chan struct{}
+
+	mux    sync.Mutex
+	status JobStatus
+}
+
+type jobOption func(j *job)
+
+// WithJitter delays every activation by a random duration in [0, jitter), to spread jobs of many replicas.
+func WithJitter(jitter time.Duration) jobOption {
+	return func(j *job) {
+		j.jitter = jitter
+	}
+}
+
+// WithTimeout cancels the ctx of a run after timeout.
+func WithTimeout(timeout time.Duration) jobOption {
+	return func(j *job) {
+		j.timeout = timeout
+	}
+}
+
+func WithOverlapPolicy(policy OverlapPolicy) jobOption {
+	return func(j *job) {
+		j.overlap = policy
+	}
+}
+
+// Scheduler runs jobs on cron or interval schedules, each job in its own goroutine, runs of one job never overlap.
+type Scheduler struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	mux     sync.RWMutex
+	jobs    map[string]*job
+	started bool
+	stopped bool
+}
+
+func NewScheduler() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		ctx:      ctx,
+		cancel:   cancel,
+		stopChan: make(chan struct{}),
+		jobs:     make(map[string]*job),
+	}
+}
+
+// AddCron adds a job on a cron expression, see ParseCron.
+func (s *Scheduler) AddCron(name, expr string, fn JobFunc, opts ...jobOption) error {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return err
+	}
+	return s.Add(name, schedule, fn, opts...)
+}
+
+func (s *Scheduler) AddInterval(name string, every time.Duration, fn JobFunc, opts ...jobOption) error {
+	if every <= 0 {
+		return fmt.Errorf("interval must be greater than 0, got %v", every)
+	}
+	return s.Add(name, Every(every), fn, opts...)
+}
+
+// Add adds a job, jobs added after Start start immediately.
+func (s *Scheduler) Add(name string, schedule Schedule, fn JobFunc, opts ...jobOption) error {
+	if schedule == nil || fn == nil {
+		return fmt.Errorf("schedule and fn cannot be nil")
+	}
+	j := &job{
+		name:     name,
+		schedule: schedule,
+		fn:       fn,
+		status:   JobStatus{Name: name, Schedule: fmt.Sprint(schedule)},
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	if j.overlap == OverlapQueue {
+		j.triggers = make(chan struct{}, maxQueuedRuns)
+	} else {
+		j.triggers = make(chan struct{})
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stopped {
+		return ErrSchedulerStopped
+	}
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+	}
+	s.jobs[name] = j
+	if s.started {
+		s.startJob(j)
+	}
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobs {
+		s.startJob(j)
+	}
+}
+
+// Stop stops scheduling and waits for the running jobs until ctx is done, then cancels their ctx
+// and returns ctx.Err(). Queued runs are dropped.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mux.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stopChan)
+	}
+	s.mux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) Status() []JobStatus {
+	s.mux.RLock()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mux.Lock()
+		statuses = append(statuses, j.status)
+		j.mux.Unlock()
+	}
+	s.mux.RUnlock()
+
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].Name < statuses[k].Name
+	})
+	return statuses
+}
+
+// StatusHandler serves Status as json, use gin.WrapF to mount it on a gin router.
+func (s *Scheduler) StatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := jsoniter.Marshal(s.Status())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+func (s *Scheduler) startJob(j *job) {
+	s.wg.Add(2)
+	go util.WithRecover(func() {
+		defer s.wg.Done()
+		s.trigger(j)
+	})
+	go util.WithRecover(func() {
+		defer s.wg.Done()
+		s.execute(j)
+	})
+}
+
+// trigger waits for the activations of j and hands them to execute according to the overlap policy.
+func (s *Scheduler) trigger(j *job) {
+	last := time.Now()
+	for {
+		next := j.schedule.Next(last)
+		if next.IsZero() {
+			log.Warn("scheduler job has no next run", log.Str("job", j.name))
+			return
+		}
+		last = next
+		fireAt := next
+		if j.jitter > 0 {
+			fireAt = fireAt.Add(rand.N(j.jitter))
+		}
+		j.mux.Lock()
+		j.status.NextRun = fireAt
+		j.mux.Unlock()
+
+		timer := time.NewTimer(time.Until(fireAt))
+		select {
+		case <-s.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case j.triggers <- struct{}{}:
+		default:
+			j.mux.Lock()
+			j.status.Skipped++
+			j.mux.Unlock()
+			log.Warn("scheduler job skipped, previous run still running", log.Str("job", j.name))
+		}
+		// don't fire the missed activations of a long run one after another
+		if now := time.Now(); last.Before(now) {
+			last = now
+		}
+	}
+}
+
+func (s *Scheduler) execute(j *job) {
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-j.triggers:
+			select {
+			case <-s.stopChan:
+				return
+			default:
+			}
+			s.run(j)
+		}
+	}
+}
+
+func (s *Scheduler) run(j *job) {
+	ctx := s.ctx
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	j.mux.Lock()
+	j.status.Running = true
+	j.status.LastRun = start
+	j.mux.Unlock()
+
+	var err error
+	util.WithRecover(func() {
+		err = j.fn(ctx)
+	}, func(panicErr interface{}) {
+		util.DefaultPanicWithCtx(ctx, panicErr)
+		err = util.NewPanicError(panicErr)
+	})
+	if err != nil {
+		log.Error("scheduler job failed", log.Str("job", j.name), log.Err(err))
+	}
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	j.status.Running = false
+	j.status.LastDuration = time.Since(start)
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+}
@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC) // a wednesday
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 9-18 * * 1-5", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * 0", time.Date(2024, 2, 4, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 3", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, // either day field matches
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("Expected %q to parse, got %v", c.expr, err)
+		}
+		if next := schedule.Next(base); !next.Equal(c.expected) {
+			t.Errorf("Expected next of %q to be %v, got %v", c.expr, c.expected, next)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every x"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("Expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	s := NewScheduler()
+	var runs atomic.Int32
+	_ = s.AddInterval("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		time.Sleep(35 * time.Millisecond)
+		return errors.New("failed")
+	})
+	s.Start()
+	time.Sleep(100 * time.Millisecond)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Expected a graceful stop, got %v", err)
+	}
+
+	status := s.Status()[0]
+	if status.Runs != uint64(runs.Load()) || status.Failures != status.Runs || status.LastError != "failed" {
+		t.Errorf("Expected every run to be recorded as failed, got %+v", status)
+	}
+	if status.Runs > 4 || status.Skipped == 0 {
+		t.Errorf("Expected overlapping runs to be skipped, got %+v", status)
+	}
+}
+
+func TestSchedulerTimeoutPanicAndStop(t *testing.T) {
+	s := NewScheduler()
+	_ = s.AddInterval("panic", 10*time.Millisecond, func(ctx context.Context) error {
+		panic("boom")
+	})
+	_ = s.AddInterval("timeout", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(5*time.Millisecond))
+	_ = s.AddInterval("stuck", 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	if err := s.AddInterval("stuck", time.Second, func(ctx context.Context) error { return nil }); !errors.Is(err, ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+	s.Start()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the stuck job to make Stop time out, got %v", err)
+	}
+
+	for _, status := range s.Status() {
+		switch status.Name {
+		case "panic":
+			if status.Failures == 0 || status.LastError != "panic: boom" {
+				t.Errorf("Expected the panic to be recorded, got %+v", status)
+			}
+		case "timeout":
+			if status.LastError != context.DeadlineExceeded.Error() {
+				t.Errorf("Expected the run to time out, got %+v", status)
+			}
+		}
+	}
+}
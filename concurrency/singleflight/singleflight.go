@@ -0,0 +1,173 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/util"
+	"github.com/gw-gong/gwkit-go/util/trace"
+)
+
+// Group coalesces concurrent calls with the same key into one call, and optionally keeps successful results
+// for a short ttl. Errors are never kept, the next call after an error runs again.
+type Group[K comparable, V any] struct {
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+
+	mux   sync.Mutex
+	calls map[K]*call[V]
+	cache map[K]*entry[V]
+
+	executed  atomic.Uint64
+	coalesced atomic.Uint64
+	cacheHits atomic.Uint64
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+type Stats struct {
+	Executed  uint64 // calls of fn
+	Coalesced uint64 // calls that waited for a call of another caller instead of calling fn
+	CacheHits uint64 // calls answered from the ttl cache
+}
+
+type groupOptions struct {
+	timeout time.Duration
+}
+
+type option func(o *groupOptions)
+
+// WithTimeout bounds every call of fn, so a hung fn is cancelled even if the caller that started it has no deadline.
+func WithTimeout(timeout time.Duration) option {
+	return func(o *groupOptions) {
+		if timeout > 0 {
+			o.timeout = timeout
+		}
+	}
+}
+
+// NewGroup creates a Group, ttl <= 0 disables result caching.
+func NewGroup[K comparable, V any](ttl time.Duration, opts ...option) *Group[K, V] {
+	options := &groupOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &Group[K, V]{
+		ttl:     ttl,
+		timeout: options.timeout,
+		now:     time.Now,
+		calls:   make(map[K]*call[V]),
+		cache:   make(map[K]*entry[V]),
+	}
+}
+
+// Do returns the cached result of key, or waits for the running call of key, or calls fn.
+// fn runs with trace.CopyCtx(ctx) of the caller that started it, so the cancellation or deadline of ctx only stops
+// this caller from waiting, the shared call keeps running for the others. Use WithTimeout to bound the shared call.
+// shared reports whether the result was not produced by this caller's own call of fn.
+// A panic in fn is returned to every caller as *util.PanicError.
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (value V, shared bool, err error) {
+	g.mux.Lock()
+	if e, ok := g.cache[key]; ok {
+		if g.now().Before(e.expiresAt) {
+			g.mux.Unlock()
+			g.cacheHits.Add(1)
+			return e.value, true, nil
+		}
+		delete(g.cache, key)
+	}
+
+	c, ok := g.calls[key]
+	if ok {
+		g.mux.Unlock()
+		g.coalesced.Add(1)
+		shared = true
+	} else {
+		c = &call[V]{done: make(chan struct{})}
+		g.calls[key] = c
+		g.mux.Unlock()
+		g.executed.Add(1)
+		callCtx, cancel := g.callCtx(ctx)
+		go func() {
+			defer cancel()
+			g.doCall(callCtx, key, c, fn)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		var zero V
+		return zero, shared, ctx.Err()
+	case <-c.done:
+		return c.value, shared, c.err
+	}
+}
+
+// callCtx keeps the trace of ctx without its cancellation and deadline, and applies the group timeout.
+func (g *Group[K, V]) callCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	callCtx := trace.CopyCtx(ctx)
+	if g.timeout > 0 {
+		return context.WithTimeout(callCtx, g.timeout)
+	}
+	return callCtx, func() {}
+}
+
+func (g *Group[K, V]) doCall(ctx context.Context, key K, c *call[V], fn func(ctx context.Context) (V, error)) {
+	util.WithRecover(func() {
+		c.value, c.err = fn(ctx)
+	}, func(panicErr interface{}) {
+		util.DefaultPanicWithCtx(ctx, panicErr)
+		c.err = util.NewPanicError(panicErr)
+	})
+
+	g.mux.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+		if c.err == nil && g.ttl > 0 {
+			g.cache[key] = &entry[V]{value: c.value, expiresAt: g.now().Add(g.ttl)}
+			g.scheduleExpireLocked(key)
+		}
+	}
+	g.mux.Unlock()
+	close(c.done)
+}
+
+// scheduleExpireLocked removes the cache entry after ttl, so keys that are never asked again don't stay in memory.
+func (g *Group[K, V]) scheduleExpireLocked(key K) {
+	e := g.cache[key]
+	time.AfterFunc(g.ttl, func() {
+		g.mux.Lock()
+		defer g.mux.Unlock()
+		if g.cache[key] == e {
+			delete(g.cache, key)
+		}
+	})
+}
+
+// Forget drops the cached result of key and detaches a running call, the next Do of key calls fn again.
+func (g *Group[K, V]) Forget(key K) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	delete(g.cache, key)
+	delete(g.calls, key)
+}
+
+func (g *Group[K, V]) Stats() Stats {
+	return Stats{
+		Executed:  g.executed.Load(),
+		Coalesced: g.coalesced.Load(),
+		CacheHits: g.cacheHits.Load(),
+	}
+}
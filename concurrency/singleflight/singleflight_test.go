@@ -0,0 +1,160 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoCoalescesConcurrentCalls(t *testing.T) {
+	g := NewGroup[string, int](0)
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, _, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+				calls.Add(1)
+				<-release
+				return 42, nil
+			})
+			if value != 42 || err != nil {
+				t.Errorf("Expected (42, nil), got (%d, %v)", value, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 call, got %d", calls.Load())
+	}
+	if stats := g.Stats(); stats.Executed != 1 || stats.Coalesced != 9 {
+		t.Errorf("Expected 1 executed and 9 coalesced, got %+v", stats)
+	}
+}
+
+func TestDoCachesSuccessAndForgetsErrors(t *testing.T) {
+	g := NewGroup[string, int](time.Minute)
+	now := time.Unix(1700000000, 0)
+	g.now = func() time.Time { return now }
+
+	var calls int
+	errFail := errors.New("fail")
+	fn := func(ctx context.Context) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, errFail
+		}
+		return calls, nil
+	}
+
+	if _, _, err := g.Do(context.Background(), "key", fn); !errors.Is(err, errFail) {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+	if value, _, _ := g.Do(context.Background(), "key", fn); value != 2 {
+		t.Errorf("Expected the error not to be cached, got %d", value)
+	}
+	if value, shared, _ := g.Do(context.Background(), "key", fn); value != 2 || !shared {
+		t.Errorf("Expected the cached value 2, got %d (shared %v)", value, shared)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if value, _, _ := g.Do(context.Background(), "key", fn); value != 3 {
+		t.Errorf("Expected the cache to expire, got %d", value)
+	}
+	if stats := g.Stats(); stats.CacheHits != 1 {
+		t.Errorf("Expected 1 cache hit, got %+v", stats)
+	}
+}
+
+func TestWaiterCancelDoesNotCancelSharedCall(t *testing.T) {
+	g := NewGroup[string, int](0)
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		<-release
+		return 1, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := g.Do(ctx, "key", fn)
+		errCh <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	resultCh := make(chan error, 1)
+	go func() {
+		_, _, err := g.Do(context.Background(), "key", fn)
+		resultCh <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled waiter to get context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-resultCh; err != nil {
+		t.Errorf("Expected the shared call to keep running, got %v", err)
+	}
+}
+
+func TestSharedCallOutlivesDeadlineOfFirstCaller(t *testing.T) {
+	g := NewGroup[string, int](0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slow := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	firstErr := make(chan error, 1)
+	go func() {
+		_, _, err := g.Do(ctx, "key", slow)
+		firstErr <- err
+	}()
+	<-started
+	resultCh := make(chan error, 1)
+	go func() {
+		_, _, err := g.Do(context.Background(), "key", slow)
+		resultCh <- err
+	}()
+
+	if err := <-firstErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the first caller to stop waiting at its deadline, got %v", err)
+	}
+	close(release)
+	if err := <-resultCh; err != nil {
+		t.Errorf("Expected the shared call to keep running after the first caller timed out, got %v", err)
+	}
+}
+
+func TestGroupTimeoutStopsHungCall(t *testing.T) {
+	g := NewGroup[string, int](0, WithTimeout(20*time.Millisecond))
+	hung := func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	if _, _, err := g.Do(context.Background(), "key", hung); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the hung call to stop at the group timeout, got %v", err)
+	}
+	if _, _, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 1, nil }); err != nil {
+		t.Errorf("Expected the next call to run again after the timeout, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package featureflag
+
+type FlagType string
+
+const (
+	FlagTypeBool       FlagType = "bool"
+	FlagTypePercentage FlagType = "percentage"
+)
+
+type Operator string
+
+const (
+	OperatorIn    Operator = "in"
+	OperatorNotIn Operator = "not_in"
+)
+
+// Config is the hot-reloadable source of all flags, keyed by flag name.
+// viper lowercases keys, so flag names loaded through hotcfg should be lower case.
+type Config struct {
+	Flags map[string]*FlagConfig `json:"flags" yaml:"flags" mapstructure:"flags"`
+}
+
+type FlagConfig struct {
+	Type FlagType `json:"type" yaml:"type" mapstructure:"type"`
+	// kill switch, a disabled flag is always off regardless of rules
+	Enabled bool `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	// rollout percentage (0-100) of percentage flags
+	Percentage float64 `json:"percentage" yaml:"percentage" mapstructure:"percentage"`
+	// attribute used as bucketing key, default AttributeUserID
+	StickyBy string `json:"sticky_by" yaml:"sticky_by" mapstructure:"sticky_by"`
+	// targeting rules, the first matching rule decides the result
+	Rules []Rule `json:"rules" yaml:"rules" mapstructure:"rules"`
+}
+
+type Rule struct {
+	Attribute string   `json:"attribute" yaml:"attribute" mapstructure:"attribute"`
+	Operator  Operator `json:"operator" yaml:"operator" mapstructure:"operator"` // default OperatorIn
+	Values    []string `json:"values" yaml:"values" mapstructure:"values"`
+	Enabled   bool     `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	// optional rollout percentage (0-100) for the matched subjects, overrides Enabled when set
+	Percentage *float64 `json:"percentage" yaml:"percentage" mapstructure:"percentage"`
+}
@@ -0,0 +1,62 @@
+package featureflag
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/setting"
+)
+
+const (
+	AttributeUserID = "user_id"
+	AttributeTenant = "tenant"
+	AttributeEnv    = "env"
+)
+
+type ctxKeyAttributes struct{}
+
+// WithAttribute returns a context carrying the attribute used by targeting rules and sticky bucketing.
+func WithAttribute(ctx context.Context, key, value string) context.Context {
+	return WithAttributes(ctx, map[string]string{key: value})
+}
+
+func WithAttributes(ctx context.Context, attrs map[string]string) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+	parent := getAttributesFromCtx(ctx)
+	merged := make(map[string]string, len(parent)+len(attrs))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, ctxKeyAttributes{}, merged)
+}
+
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return WithAttribute(ctx, AttributeUserID, userID)
+}
+
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return WithAttribute(ctx, AttributeTenant, tenant)
+}
+
+// GetAttribute returns the attribute from ctx, AttributeEnv falls back to setting.GetEnv().
+func GetAttribute(ctx context.Context, key string) string {
+	if value, ok := getAttributesFromCtx(ctx)[key]; ok {
+		return value
+	}
+	if key == AttributeEnv {
+		return string(setting.GetEnv())
+	}
+	return ""
+}
+
+func getAttributesFromCtx(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxKeyAttributes{}).(map[string]string)
+	return attrs
+}
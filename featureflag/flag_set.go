@@ -0,0 +1,197 @@
+package featureflag
+
+import (
+	"context"
+	"hash/fnv"
+	"sync/atomic"
+
+	"github.com/gw-gong/gwkit-go/log"
+)
+
+const bucketCount = 10000 // 0.01% granularity
+
+// FlagSet evaluates flags against an immutable snapshot, Update swaps the snapshot atomically
+// so evaluation never takes a lock.
+type FlagSet struct {
+	snapshot atomic.Pointer[snapshot]
+}
+
+type snapshot struct {
+	flags map[string]*compiledFlag
+}
+
+type compiledFlag struct {
+	name       string
+	flagType   FlagType
+	enabled    bool
+	percentage float64
+	stickyBy   string
+	rules      []compiledRule
+}
+
+type compiledRule struct {
+	attribute  string
+	operator   Operator
+	values     map[string]struct{}
+	enabled    bool
+	percentage *float64
+}
+
+func NewFlagSet(cfg *Config) *FlagSet {
+	fs := &FlagSet{}
+	fs.Update(cfg)
+	return fs
+}
+
+// Update replaces all flags with cfg, a nil cfg removes all flags.
+func (fs *FlagSet) Update(cfg *Config) {
+	fs.snapshot.Store(compile(cfg))
+}
+
+// IsEnabled reports whether the flag is on for the attributes carried by ctx, unknown flags are off.
+func (fs *FlagSet) IsEnabled(ctx context.Context, name string) bool {
+	flag, ok := fs.snapshot.Load().flags[name]
+	if !ok {
+		return false
+	}
+	return flag.evaluate(ctx)
+}
+
+// EvaluateAll returns the state of every flag for ctx, e.g. to expose them to a frontend.
+func (fs *FlagSet) EvaluateAll(ctx context.Context) map[string]bool {
+	flags := fs.snapshot.Load().flags
+	result := make(map[string]bool, len(flags))
+	for name, flag := range flags {
+		result[name] = flag.evaluate(ctx)
+	}
+	return result
+}
+
+func compile(cfg *Config) *snapshot {
+	s := &snapshot{flags: make(map[string]*compiledFlag)}
+	if cfg == nil {
+		return s
+	}
+	for name, flagCfg := range cfg.Flags {
+		if flagCfg == nil {
+			continue
+		}
+		flag := &compiledFlag{
+			name:       name,
+			flagType:   flagCfg.Type,
+			enabled:    flagCfg.Enabled,
+			percentage: flagCfg.Percentage,
+			stickyBy:   flagCfg.StickyBy,
+			rules:      make([]compiledRule, 0, len(flagCfg.Rules)),
+		}
+		if flag.flagType == "" {
+			flag.flagType = FlagTypeBool
+		}
+		if flag.flagType != FlagTypeBool && flag.flagType != FlagTypePercentage {
+			log.Warn("unknown feature flag type, treat as bool", log.Str("flag", name), log.Str("type", string(flag.flagType)))
+			flag.flagType = FlagTypeBool
+		}
+		if flag.stickyBy == "" {
+			flag.stickyBy = AttributeUserID
+		}
+		for _, ruleCfg := range flagCfg.Rules {
+			rule := compiledRule{
+				attribute:  ruleCfg.Attribute,
+				operator:   ruleCfg.Operator,
+				values:     make(map[string]struct{}, len(ruleCfg.Values)),
+				enabled:    ruleCfg.Enabled,
+				percentage: ruleCfg.Percentage,
+			}
+			if rule.operator == "" {
+				rule.operator = OperatorIn
+			}
+			for _, value := range ruleCfg.Values {
+				rule.values[value] = struct{}{}
+			}
+			flag.rules = append(flag.rules, rule)
+		}
+		s.flags[name] = flag
+	}
+	return s
+}
+
+func (f *compiledFlag) evaluate(ctx context.Context) bool {
+	if !f.enabled {
+		return false
+	}
+	for _, rule := range f.rules {
+		if !rule.match(ctx) {
+			continue
+		}
+		if rule.percentage != nil {
+			return f.inRollout(ctx, *rule.percentage)
+		}
+		return rule.enabled
+	}
+	if f.flagType == FlagTypePercentage {
+		return f.inRollout(ctx, f.percentage)
+	}
+	return true
+}
+
+// inRollout hashes the sticky key with the flag name, so a subject stays in the same bucket across reloads
+// while different flags roll out to different subjects.
+func (f *compiledFlag) inRollout(ctx context.Context, percentage float64) bool {
+	if percentage >= 100 {
+		return true
+	}
+	if percentage <= 0 {
+		return false
+	}
+	key := GetAttribute(ctx, f.stickyBy)
+	if key == "" {
+		return false
+	}
+	return float64(bucket(f.name, key)) < percentage*bucketCount/100
+}
+
+func bucket(flagName, key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(flagName))
+	_, _ = h.Write([]byte{':'})
+	_, _ = h.Write([]byte(key))
+	return h.Sum32() % bucketCount
+}
+
+func (r *compiledRule) match(ctx context.Context) bool {
+	_, in := r.values[GetAttribute(ctx, r.attribute)]
+	switch r.operator {
+	case OperatorIn:
+		return in
+	case OperatorNotIn:
+		return !in
+	}
+	return false
+}
+
+// ================================ Global FlagSet ================================
+
+var globalFlagSet atomic.Pointer[FlagSet]
+
+func init() {
+	globalFlagSet.Store(NewFlagSet(nil))
+}
+
+// ReplaceGlobals sets the FlagSet used by the package level functions.
+func ReplaceGlobals(fs *FlagSet) {
+	if fs != nil {
+		globalFlagSet.Store(fs)
+	}
+}
+
+func L() *FlagSet {
+	return globalFlagSet.Load()
+}
+
+func IsEnabled(ctx context.Context, name string) bool {
+	return L().IsEnabled(ctx, name)
+}
+
+func EvaluateAll(ctx context.Context) map[string]bool {
+	return L().EvaluateAll(ctx)
+}
@@ -0,0 +1,96 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/setting"
+)
+
+func TestBoolFlag(t *testing.T) {
+	fs := NewFlagSet(&Config{Flags: map[string]*FlagConfig{
+		"on":  {Type: FlagTypeBool, Enabled: true},
+		"off": {Type: FlagTypeBool, Enabled: false},
+	}})
+	ctx := context.Background()
+
+	if !fs.IsEnabled(ctx, "on") {
+		t.Errorf("Expected flag 'on' to be enabled")
+	}
+	if fs.IsEnabled(ctx, "off") {
+		t.Errorf("Expected flag 'off' to be disabled")
+	}
+	if fs.IsEnabled(ctx, "unknown") {
+		t.Errorf("Expected unknown flag to be disabled")
+	}
+}
+
+func TestPercentageFlagIsSticky(t *testing.T) {
+	fs := NewFlagSet(&Config{Flags: map[string]*FlagConfig{
+		"rollout": {Type: FlagTypePercentage, Enabled: true, Percentage: 30},
+	}})
+
+	enabledCount := 0
+	for i := 0; i < 10000; i++ {
+		ctx := WithUserID(context.Background(), fmt.Sprintf("user-%d", i))
+		first := fs.IsEnabled(ctx, "rollout")
+		if first != fs.IsEnabled(ctx, "rollout") {
+			t.Fatalf("Expected the same result for the same user")
+		}
+		if first {
+			enabledCount++
+		}
+	}
+	if enabledCount < 2700 || enabledCount > 3300 {
+		t.Errorf("Expected about 30%% of users enabled, got %d/10000", enabledCount)
+	}
+
+	if fs.IsEnabled(context.Background(), "rollout") {
+		t.Errorf("Expected percentage flag without sticky key to be disabled")
+	}
+}
+
+func TestTargetingRules(t *testing.T) {
+	zero := 0.0
+	fs := NewFlagSet(&Config{Flags: map[string]*FlagConfig{
+		"beta": {
+			Type:       FlagTypePercentage,
+			Enabled:    true,
+			Percentage: 100,
+			Rules: []Rule{
+				{Attribute: AttributeTenant, Values: []string{"blocked"}, Percentage: &zero},
+				{Attribute: AttributeUserID, Operator: OperatorIn, Values: []string{"u1"}, Enabled: true},
+				{Attribute: AttributeEnv, Operator: OperatorNotIn, Values: []string{string(setting.ENV_TEST)}, Enabled: false},
+			},
+		},
+	}})
+
+	prevEnv := setting.GetEnv()
+	setting.SetEnv(setting.ENV_LIVE)
+	defer setting.SetEnv(prevEnv)
+
+	ctx := WithUserID(context.Background(), "u1")
+	if !fs.IsEnabled(ctx, "beta") {
+		t.Errorf("Expected user rule to enable the flag")
+	}
+	if fs.IsEnabled(WithTenant(ctx, "blocked"), "beta") {
+		t.Errorf("Expected tenant rule to take precedence and disable the flag")
+	}
+	if fs.IsEnabled(WithUserID(context.Background(), "u2"), "beta") {
+		t.Errorf("Expected env rule to disable the flag in live env")
+	}
+	if !fs.IsEnabled(WithAttribute(WithUserID(context.Background(), "u2"), AttributeEnv, string(setting.ENV_TEST)), "beta") {
+		t.Errorf("Expected env attribute in ctx to override setting.GetEnv()")
+	}
+}
+
+func TestUpdateReplacesFlags(t *testing.T) {
+	fs := NewFlagSet(&Config{Flags: map[string]*FlagConfig{"a": {Enabled: true}}})
+	fs.Update(&Config{Flags: map[string]*FlagConfig{"b": {Enabled: true}}})
+
+	all := fs.EvaluateAll(context.Background())
+	if len(all) != 1 || !all["b"] {
+		t.Errorf("Expected only flag 'b' after update, got %v", all)
+	}
+}
@@ -0,0 +1,40 @@
+package featureflag
+
+import (
+	"fmt"
+
+	"github.com/gw-gong/gwkit-go/hotcfg"
+	"github.com/gw-gong/gwkit-go/log"
+)
+
+// HotFlagSet is a hotcfg.HotLoader feeding a FlagSet, register it to a hotcfg.HotLoaderManager
+// and the flags are re-read on every LoadConfig.
+type HotFlagSet struct {
+	hotcfg.BaseConfigCapable
+	*FlagSet
+}
+
+// NewHotFlagSet loads the initial flags from base, whose content must decode into Config.
+func NewHotFlagSet(base hotcfg.BaseConfigCapable) (*HotFlagSet, error) {
+	if base == nil {
+		return nil, fmt.Errorf("base config is nil")
+	}
+	cfg := &Config{}
+	if err := base.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal feature flags: %w", err)
+	}
+	return &HotFlagSet{
+		BaseConfigCapable: base,
+		FlagSet:           NewFlagSet(cfg),
+	}, nil
+}
+
+func (h *HotFlagSet) LoadConfig() {
+	cfg := &Config{}
+	if err := h.Unmarshal(cfg); err != nil {
+		log.Error("failed to unmarshal feature flags, keep the previous flags", log.Err(err))
+		return
+	}
+	h.Update(cfg)
+	log.Info("feature flags reloaded", log.Int("count", len(cfg.Flags)))
+}
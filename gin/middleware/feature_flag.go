@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gw-gong/gwkit-go/featureflag"
+	"github.com/gw-gong/gwkit-go/gin/res"
+	"github.com/gw-gong/gwkit-go/http/code"
+
+	"github.com/gin-gonic/gin"
+)
+
+var defaultFeatureFlagHeaderAttributes = map[string]string{
+	"X-User-Id":   featureflag.AttributeUserID,
+	"X-Tenant-Id": featureflag.AttributeTenant,
+}
+
+// SetFeatureFlagAttrs copies request headers into the feature flag attributes of the request context,
+// headerAttributes maps header name to attribute name, default X-User-Id and X-Tenant-Id.
+// Handlers then query flags with featureflag.IsEnabled(c.Request.Context(), name).
+func SetFeatureFlagAttrs(headerAttributes map[string]string) gin.HandlerFunc {
+	if len(headerAttributes) == 0 {
+		headerAttributes = defaultFeatureFlagHeaderAttributes
+	}
+	return func(c *gin.Context) {
+		attrs := make(map[string]string, len(headerAttributes))
+		for header, attribute := range headerAttributes {
+			if val := c.GetHeader(header); val != "" {
+				attrs[attribute] = val
+			}
+		}
+		if len(attrs) > 0 {
+			c.Request = c.Request.WithContext(featureflag.WithAttributes(c.Request.Context(), attrs))
+		}
+		c.Next()
+	}
+}
+
+// RequireFeatureFlag rejects requests with code.ErrFeatureDisabled when the global flag name is off for the request,
+// use it after SetFeatureFlagAttrs so that the targeting rules see the attributes.
+func RequireFeatureFlag(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !featureflag.IsEnabled(c.Request.Context(), name) {
+			res.ResponseError(c, code.ErrFeatureDisabled)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
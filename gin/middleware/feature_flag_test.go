@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/featureflag"
+	"github.com/gw-gong/gwkit-go/gin/res"
+	"github.com/gw-gong/gwkit-go/http/code"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replaceFeatureFlags sets the global flags for the test and restores the previous ones.
+func replaceFeatureFlags(t *testing.T, cfg *featureflag.Config) {
+	t.Helper()
+	prev := featureflag.L()
+	featureflag.ReplaceGlobals(featureflag.NewFlagSet(cfg))
+	t.Cleanup(func() {
+		featureflag.ReplaceGlobals(prev)
+	})
+}
+
+// serve serves req and returns the http status and the code of the response body.
+func serve(t *testing.T, router *gin.Engine, req *http.Request) (int, int) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response res.ServerResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected a json response, got %q", w.Body.String())
+	}
+	return w.Code, response.Code
+}
+
+func TestRequireFeatureFlag(t *testing.T) {
+	replaceFeatureFlags(t, &featureflag.Config{Flags: map[string]*featureflag.FlagConfig{
+		"beta": {Type: featureflag.FlagTypeBool, Enabled: true, Rules: []featureflag.Rule{
+			{Attribute: featureflag.AttributeUserID, Values: []string{"u1"}, Enabled: true},
+			{Attribute: featureflag.AttributeUserID, Operator: featureflag.OperatorNotIn, Values: []string{"u1"}, Enabled: false},
+		}},
+	}})
+
+	router := gin.New()
+	router.Use(SetFeatureFlagAttrs(nil), RequireFeatureFlag("beta"))
+	router.GET("/beta", func(c *gin.Context) {
+		res.ResponseSuccess(c, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/beta", nil)
+	req.Header.Set("X-User-Id", "u1")
+	if _, got := serve(t, router, req); got != code.Success.Code {
+		t.Errorf("Expected code %d for a user with the flag on, got %d", code.Success.Code, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/beta", nil)
+	req.Header.Set("X-User-Id", "u2")
+	if _, got := serve(t, router, req); got != code.ErrFeatureDisabled.Code {
+		t.Errorf("Expected code %d for a user with the flag off, got %d", code.ErrFeatureDisabled.Code, got)
+	}
+}
+
+func TestRequireFeatureFlagUnknownFlag(t *testing.T) {
+	replaceFeatureFlags(t, &featureflag.Config{})
+
+	router := gin.New()
+	router.Use(RequireFeatureFlag("unknown"))
+	router.GET("/", func(c *gin.Context) {
+		t.Errorf("Expected the handler not to run for an unknown flag")
+	})
+	if _, got := serve(t, router, httptest.NewRequest(http.MethodGet, "/", nil)); got != code.ErrFeatureDisabled.Code {
+		t.Errorf("Expected code %d for an unknown flag, got %d", code.ErrFeatureDisabled.Code, got)
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/gw-gong/gwkit-go/concurrency/ratelimit"
+	"github.com/gw-gong/gwkit-go/gin/res"
+	"github.com/gw-gong/gwkit-go/http/code"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit rejects requests with code.ErrTooManyRequests once the limiter is exhausted.
+func RateLimit(limiter ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiter.Allow() {
+			res.ResponseError(c, code.ErrTooManyRequests)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitByKey limits requests per key, e.g. per user or per client ip. keyFunc defaults to c.ClientIP().
+func RateLimitByKey(limiter *ratelimit.KeyedLimiter, keyFunc func(c *gin.Context) string) gin.HandlerFunc {
+	if keyFunc == nil {
+		keyFunc = func(c *gin.Context) string {
+			return c.ClientIP()
+		}
+	}
+	return func(c *gin.Context) {
+		if !limiter.Allow(keyFunc(c)) {
+			res.ResponseError(c, code.ErrTooManyRequests)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/concurrency/ratelimit"
+	"github.com/gw-gong/gwkit-go/gin/res"
+	"github.com/gw-gong/gwkit-go/http/code"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitConfig allows 2 requests per key during the test.
+var rateLimitConfig = &ratelimit.Config{Algorithm: ratelimit.AlgorithmSlidingWindow, Limit: 2, WindowMs: 60000}
+
+func newRateLimitRouter(middleware gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(middleware)
+	router.GET("/test", func(c *gin.Context) {
+		res.ResponseSuccess(c, nil)
+	})
+	return router
+}
+
+func requestFrom(t *testing.T, router *gin.Engine, remoteAddr string) (int, int) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = remoteAddr
+	return serve(t, router, req)
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(rateLimitConfig)
+	if err != nil {
+		t.Fatalf("Expected limiter to be created, got %v", err)
+	}
+	router := newRateLimitRouter(RateLimit(limiter))
+
+	for i := 0; i < 2; i++ {
+		if status, got := requestFrom(t, router, "10.0.0.1:1000"); status != http.StatusOK || got != code.Success.Code {
+			t.Fatalf("Expected request %d to pass, got status %d and code %d", i, status, got)
+		}
+	}
+	status, got := requestFrom(t, router, "10.0.0.2:1000")
+	if status != http.StatusTooManyRequests || got != code.ErrTooManyRequests.Code {
+		t.Errorf("Expected status 429 and code %d over the limit, got %d and %d", code.ErrTooManyRequests.Code, status, got)
+	}
+}
+
+func TestRateLimitByKey(t *testing.T) {
+	limiter, err := ratelimit.NewKeyedLimiter(rateLimitConfig, 10)
+	if err != nil {
+		t.Fatalf("Expected limiter to be created, got %v", err)
+	}
+	router := newRateLimitRouter(RateLimitByKey(limiter, nil))
+
+	for i := 0; i < 2; i++ {
+		_, _ = requestFrom(t, router, "10.0.0.1:1000")
+	}
+	if status, got := requestFrom(t, router, "10.0.0.1:1000"); status != http.StatusTooManyRequests || got != code.ErrTooManyRequests.Code {
+		t.Errorf("Expected the third request of 10.0.0.1 to be limited, got status %d and code %d", status, got)
+	}
+	if status, got := requestFrom(t, router, "10.0.0.2:1000"); status != http.StatusOK || got != code.Success.Code {
+		t.Errorf("Expected 10.0.0.2 to have its own limit, got status %d and code %d", status, got)
+	}
+}
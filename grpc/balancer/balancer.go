@@ -0,0 +1,194 @@
+package balancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gw-gong/gwkit-go/grpc/registry"
+
+	jsoniter "github.com/json-iterator/go"
+	grpc_balancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// Policy is a client side load balancing policy, see ServiceConfig.
+type Policy string
+
+const (
+	PolicyPickFirst          Policy = "pick_first" // grpc default, all calls go to one instance
+	PolicyRoundRobin         Policy = "round_robin"
+	PolicyWeightedRoundRobin Policy = "weighted_round_robin" // weights from the instance meta WeightMetaKey or the passing weight
+	PolicyLeastRequest       Policy = "least_request"        // the less busy of two random instances
+	PolicyConsistentHash     Policy = "consistent_hash"      // the same outgoing metadata value goes to the same instance
+)
+
+// names of the balancers registered by this package
+const (
+	WeightedRoundRobinName = "gwkit_weighted_round_robin"
+	LeastRequestName       = "gwkit_least_request"
+	ConsistentHashName     = "gwkit_consistent_hash"
+)
+
+// WeightMetaKey is the instance meta key read by PolicyWeightedRoundRobin, it takes precedence over the passing weight.
+const WeightMetaKey = "weight"
+
+func init() {
+	grpc_balancer.Register(&builder{name: WeightedRoundRobinName, newPicker: newWeightedRoundRobinPicker})
+	grpc_balancer.Register(&builder{name: LeastRequestName, newPicker: newLeastRequestPicker})
+	grpc_balancer.Register(&builder{name: ConsistentHashName, newPicker: newConsistentHashPicker})
+}
+
+// ServiceConfig returns the service config selecting policy, pass it with grpc.WithDefaultServiceConfig.
+// hashKey is the outgoing metadata key hashed by PolicyConsistentHash, calls without it are spread round robin.
+// The weights are only known with the resolver of registry.NewResolverBuilder, other resolvers get weight 1.
+func ServiceConfig(policy Policy, hashKey string) (string, error) {
+	var name string
+	cfg := &lbConfig{}
+	switch policy {
+	case "", PolicyPickFirst:
+		name = string(PolicyPickFirst)
+	case PolicyRoundRobin:
+		name = string(PolicyRoundRobin)
+	case PolicyWeightedRoundRobin:
+		name = WeightedRoundRobinName
+	case PolicyLeastRequest:
+		name = LeastRequestName
+	case PolicyConsistentHash:
+		if hashKey == "" {
+			return "", fmt.Errorf("hash key is required for %s", policy)
+		}
+		name = ConsistentHashName
+		cfg.HashKey = hashKey
+	default:
+		return "", fmt.Errorf("unknown load balancing policy: %s", policy)
+	}
+	serviceConfig, err := jsoniter.Marshal(map[string]interface{}{
+		"loadBalancingConfig": []map[string]interface{}{{name: cfg}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal service config: %w", err)
+	}
+	return string(serviceConfig), nil
+}
+
+type lbConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	HashKey string `json:"hashKey,omitempty"`
+}
+
+// endpoint is a ready SubConn with the registry instance behind it, instance is nil with other resolvers.
+type endpoint struct {
+	subConn  grpc_balancer.SubConn
+	addr     string
+	instance *registry.ServiceInstance
+}
+
+type pickerFactory func(endpoints []*endpoint, state *balancerState) grpc_balancer.Picker
+
+// builder builds a base balancer, which manages the SubConns, with the picker of newPicker.
+type builder struct {
+	name      string
+	newPicker pickerFactory
+}
+
+func (b *builder) Name() string {
+	return b.name
+}
+
+func (b *builder) Build(cc grpc_balancer.ClientConn, opts grpc_balancer.BuildOptions) grpc_balancer.Balancer {
+	state := &balancerState{
+		cfg:       &lbConfig{},
+		instances: make(map[string]*registry.ServiceInstance),
+		inFlight:  make(map[grpc_balancer.SubConn]*atomic.Int64),
+	}
+	pb := &pickerBuilder{state: state, newPicker: b.newPicker}
+	return &stateBalancer{
+		Balancer: base.NewBalancerBuilder(b.name, pb, base.Config{}).Build(cc, opts),
+		state:    state,
+	}
+}
+
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &lbConfig{}
+	if len(js) > 0 {
+		if err := jsoniter.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s config: %w", b.name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// balancerState is what the pickers need beyond the ready SubConns. The base balancer keeps the address a SubConn
+// was created with, so the latest instances are taken from the resolver state instead. The methods of a balancer
+// are never called concurrently, so only the counters need to be safe for the pickers.
+type balancerState struct {
+	cfg       *lbConfig
+	instances map[string]*registry.ServiceInstance // addr -> instance
+	inFlight  map[grpc_balancer.SubConn]*atomic.Int64
+}
+
+type stateBalancer struct {
+	grpc_balancer.Balancer
+	state *balancerState
+}
+
+func (b *stateBalancer) UpdateClientConnState(s grpc_balancer.ClientConnState) error {
+	if cfg, ok := s.BalancerConfig.(*lbConfig); ok {
+		b.state.cfg = cfg
+	}
+	instances := make(map[string]*registry.ServiceInstance, len(s.ResolverState.Addresses))
+	for _, addr := range s.ResolverState.Addresses {
+		if instance, ok := registry.InstanceFromAddress(addr); ok {
+			instances[addr.Addr] = instance
+		}
+	}
+	b.state.instances = instances
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+type pickerBuilder struct {
+	state     *balancerState
+	newPicker pickerFactory
+}
+
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) grpc_balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(grpc_balancer.ErrNoSubConnAvailable)
+	}
+	endpoints := make([]*endpoint, 0, len(info.ReadySCs))
+	for subConn, scInfo := range info.ReadySCs {
+		endpoints = append(endpoints, newEndpoint(subConn, scInfo.Address, pb.state.instances))
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].addr < endpoints[j].addr
+	})
+	return pb.newPicker(endpoints, pb.state)
+}
+
+func newEndpoint(subConn grpc_balancer.SubConn, addr resolver.Address, instances map[string]*registry.ServiceInstance) *endpoint {
+	e := &endpoint{subConn: subConn, addr: addr.Addr, instance: instances[addr.Addr]}
+	if e.instance == nil {
+		e.instance, _ = registry.InstanceFromAddress(addr)
+	}
+	return e
+}
+
+// weight returns the meta WeightMetaKey, else the passing weight, else 1.
+func (e *endpoint) weight() int {
+	if e.instance == nil {
+		return 1
+	}
+	if weight, err := strconv.Atoi(e.instance.Meta[WeightMetaKey]); err == nil && weight > 0 {
+		return weight
+	}
+	if e.instance.Weights.Passing > 0 {
+		return e.instance.Weights.Passing
+	}
+	return 1
+}
@@ -0,0 +1,270 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/registry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testServer is an in-process health server, its calls reply with its name in the "server" header.
+type testServer struct {
+	name     string
+	listener *bufconn.Listener
+	inFlight atomic.Int32
+	block    chan struct{} // calls wait until it is closed, nil doesn't block
+}
+
+// testCluster registers bufconn servers in a memory registry and dials them by their fake address.
+type testCluster struct {
+	registry *registry.MemoryRegistry
+	servers  map[string]*testServer // addr -> server
+}
+
+func newTestCluster() *testCluster {
+	return &testCluster{registry: registry.NewMemoryRegistry(), servers: make(map[string]*testServer)}
+}
+
+func (c *testCluster) addServer(t *testing.T, name string, meta map[string]string, block chan struct{}) *testServer {
+	t.Helper()
+	s := &testServer{name: name, listener: bufconn.Listen(1024 * 1024), block: block}
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		if s.block != nil {
+			<-s.block
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs("server", s.name))
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() {
+		_ = server.Serve(s.listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	port := len(c.servers) + 1
+	c.servers["127.0.0.1:"+strconv.Itoa(port)] = s
+	instance := &registry.ServiceInstance{ID: name, Service: "order", Address: "127.0.0.1", Port: port, Meta: meta}
+	if err := c.registry.Register(context.Background(), instance); err != nil {
+		t.Fatalf("Expected instance to be registered, got %v", err)
+	}
+	return s
+}
+
+func (c *testCluster) dial(t *testing.T, policy Policy, hashKey string) healthpb.HealthClient {
+	t.Helper()
+	serviceConfig, err := ServiceConfig(policy, hashKey)
+	if err != nil {
+		t.Fatalf("Expected service config, got %v", err)
+	}
+	conn, err := registry.NewGrpcConn(c.registry, "order", "",
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			s, ok := c.servers[addr]
+			if !ok {
+				return nil, fmt.Errorf("unknown address %s", addr)
+			}
+			return s.listener.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Expected connection to be created, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	client := healthpb.NewHealthClient(conn)
+	c.waitAllReady(t, client)
+	return client
+}
+
+// waitAllReady calls until every server answered once, so all SubConns are in the picker.
+func (c *testCluster) waitAllReady(t *testing.T, client healthpb.HealthClient) {
+	t.Helper()
+	seen := make(map[string]bool)
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; len(seen) < len(c.servers); i++ {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected all %d servers to be ready, got %v", len(c.servers), seen)
+		}
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", strconv.Itoa(i))
+		seen[call(t, ctx, client)] = true
+	}
+}
+
+// call returns the name of the server that handled the call.
+func call(t *testing.T, ctx context.Context, client healthpb.HealthClient) string {
+	t.Helper()
+	var header metadata.MD
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("Expected the call to succeed, got %v", err)
+	}
+	return header.Get("server")[0]
+}
+
+func countCalls(t *testing.T, client healthpb.HealthClient, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[call(t, context.Background(), client)]++
+	}
+	return counts
+}
+
+func TestServiceConfig(t *testing.T) {
+	cfg, err := ServiceConfig(PolicyConsistentHash, "x-user-id")
+	if err != nil || cfg != `{"loadBalancingConfig":[{"gwkit_consistent_hash":{"hashKey":"x-user-id"}}]}` {
+		t.Errorf("Expected the consistent hash config, got %s (%v)", cfg, err)
+	}
+	if _, err := ServiceConfig(PolicyConsistentHash, ""); err == nil {
+		t.Errorf("Expected an error without hash key")
+	}
+	if _, err := ServiceConfig("random", ""); err == nil {
+		t.Errorf("Expected an error for an unknown policy")
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	cluster := newTestCluster()
+	for _, name := range []string{"a", "b", "c"} {
+		cluster.addServer(t, name, nil, nil)
+	}
+	client := cluster.dial(t, PolicyRoundRobin, "")
+
+	counts := countCalls(t, client, 30)
+	for _, name := range []string{"a", "b", "c"} {
+		if counts[name] != 10 {
+			t.Errorf("Expected 10 calls on each server, got %v", counts)
+			break
+		}
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	cluster := newTestCluster()
+	cluster.addServer(t, "light", nil, nil)
+	cluster.addServer(t, "heavy", map[string]string{WeightMetaKey: "3"}, nil)
+	client := cluster.dial(t, PolicyWeightedRoundRobin, "")
+
+	counts := countCalls(t, client, 40)
+	if counts["light"] != 10 || counts["heavy"] != 30 {
+		t.Errorf("Expected the calls split 1:3, got %v", counts)
+	}
+
+	// weight changes apply without reconnecting
+	if err := cluster.registry.Register(context.Background(), &registry.ServiceInstance{
+		ID: "light", Service: "order", Address: "127.0.0.1", Port: 1, Meta: map[string]string{WeightMetaKey: "3"},
+	}); err != nil {
+		t.Fatalf("Expected instance to be updated, got %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		counts = countCalls(t, client, 60)
+		if counts["light"] == 30 && counts["heavy"] == 30 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the calls split 1:1 after the weight change, got %v", counts)
+		}
+	}
+}
+
+func TestLeastRequest(t *testing.T) {
+	cluster := newTestCluster()
+	block := make(chan struct{})
+	a := cluster.addServer(t, "a", nil, nil)
+	b := cluster.addServer(t, "b", nil, nil)
+	client := cluster.dial(t, PolicyLeastRequest, "")
+
+	// block the calls from now on, every call is picked after the previous one arrived at its server
+	a.block, b.block = block, block
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			call(t, context.Background(), client)
+		}()
+		deadline := time.Now().Add(2 * time.Second)
+		for a.inFlight.Load()+b.inFlight.Load() < int32(i) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d calls in flight, got %d", i, a.inFlight.Load()+b.inFlight.Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if inA, inB := a.inFlight.Load(), b.inFlight.Load(); inA != 5 || inB != 5 {
+		t.Errorf("Expected the calls in flight split 5:5, got %d:%d", inA, inB)
+	}
+	close(block)
+	wg.Wait()
+}
+
+func TestConsistentHash(t *testing.T) {
+	cluster := newTestCluster()
+	for _, name := range []string{"a", "b", "c"} {
+		cluster.addServer(t, name, nil, nil)
+	}
+	client := cluster.dial(t, PolicyConsistentHash, "x-user-id")
+
+	owners := make(map[string]string)
+	used := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		user := "user-" + strconv.Itoa(i)
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", user)
+		owner := call(t, ctx, client)
+		for j := 0; j < 3; j++ {
+			if again := call(t, ctx, client); again != owner {
+				t.Fatalf("Expected %s to stick to %s, got %s", user, owner, again)
+			}
+		}
+		owners[user] = owner
+		used[owner] = true
+	}
+	if len(used) < 2 {
+		t.Errorf("Expected the users to be spread over the servers, got %v", used)
+	}
+
+	counts := countCalls(t, client, 30)
+	if len(counts) != 3 {
+		t.Errorf("Expected calls without the key to be spread round robin, got %v", counts)
+	}
+
+	// only the users of the removed server move
+	if err := cluster.registry.Deregister(context.Background(), &registry.ServiceInstance{ID: "c", Service: "order"}); err != nil {
+		t.Fatalf("Expected c to be deregistered, got %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(countCalls(t, client, 10)) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected c to leave the picker")
+		}
+	}
+	for user, owner := range owners {
+		if owner == "c" {
+			continue
+		}
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", user)
+		if now := call(t, ctx, client); now != owner {
+			t.Errorf("Expected %s to stay on %s, got %s", user, owner, now)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	grpc_balancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+)
+
+// virtualNodesPerEndpoint is the number of points of an endpoint on the hash ring, more points spread the keys
+// more evenly
+const virtualNodesPerEndpoint = 100
+
+// weightedRoundRobinPicker is the smooth weighted round robin of nginx, with weights 5, 1, 1 it picks
+// a a b a c a a instead of a a a a a b c.
+type weightedRoundRobinPicker struct {
+	mux       sync.Mutex
+	endpoints []*endpoint
+	weights   []int
+	current   []int
+	total     int
+}
+
+func newWeightedRoundRobinPicker(endpoints []*endpoint, _ *balancerState) grpc_balancer.Picker {
+	p := &weightedRoundRobinPicker{
+		endpoints: endpoints,
+		weights:   make([]int, len(endpoints)),
+		current:   make([]int, len(endpoints)),
+	}
+	for i, e := range endpoints {
+		p.weights[i] = e.weight()
+		p.total += p.weights[i]
+	}
+	return p
+}
+
+func (p *weightedRoundRobinPicker) Pick(grpc_balancer.PickInfo) (grpc_balancer.PickResult, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	best := 0
+	for i := range p.endpoints {
+		p.current[i] += p.weights[i]
+		if p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+	p.current[best] -= p.total
+	return grpc_balancer.PickResult{SubConn: p.endpoints[best].subConn}, nil
+}
+
+// leastRequestPicker picks the endpoint with fewer calls in flight out of two random ones,
+// which avoids the herding of always picking the least busy endpoint.
+type leastRequestPicker struct {
+	endpoints []*endpoint
+	inFlight  []*atomic.Int64
+}
+
+func newLeastRequestPicker(endpoints []*endpoint, state *balancerState) grpc_balancer.Picker {
+	// the counters outlive the picker, calls picked by the previous picker are still in flight
+	inFlight := make(map[grpc_balancer.SubConn]*atomic.Int64, len(endpoints))
+	p := &leastRequestPicker{endpoints: endpoints, inFlight: make([]*atomic.Int64, len(endpoints))}
+	for i, e := range endpoints {
+		counter, ok := state.inFlight[e.subConn]
+		if !ok {
+			counter = &atomic.Int64{}
+		}
+		inFlight[e.subConn] = counter
+		p.inFlight[i] = counter
+	}
+	state.inFlight = inFlight
+	return p
+}
+
+func (p *leastRequestPicker) Pick(grpc_balancer.PickInfo) (grpc_balancer.PickResult, error) {
+	picked := 0
+	if n := len(p.endpoints); n > 1 {
+		picked = rand.IntN(n)
+		other := rand.IntN(n - 1)
+		if other >= picked {
+			other++
+		}
+		if p.inFlight[other].Load() < p.inFlight[picked].Load() {
+			picked = other
+		}
+	}
+	counter := p.inFlight[picked]
+	counter.Add(1)
+	return grpc_balancer.PickResult{
+		SubConn: p.endpoints[picked].subConn,
+		Done: func(grpc_balancer.DoneInfo) {
+			counter.Add(-1)
+		},
+	}, nil
+}
+
+// consistentHashPicker maps the value of the outgoing metadata hashKey onto a ring of endpoints, so the calls
+// with the same value go to the same endpoint while it's ready, and only the keys of a removed endpoint move.
+type consistentHashPicker struct {
+	hashKey   string
+	ring      []ringNode // sorted by hash
+	endpoints []*endpoint
+	next      atomic.Uint64 // round robin for calls without the key
+}
+
+type ringNode struct {
+	hash     uint64
+	endpoint *endpoint
+}
+
+func newConsistentHashPicker(endpoints []*endpoint, state *balancerState) grpc_balancer.Picker {
+	p := &consistentHashPicker{
+		hashKey:   state.cfg.HashKey,
+		ring:      make([]ringNode, 0, len(endpoints)*virtualNodesPerEndpoint),
+		endpoints: endpoints,
+	}
+	for _, e := range endpoints {
+		for i := 0; i < virtualNodesPerEndpoint; i++ {
+			p.ring = append(p.ring, ringNode{hash: hashString(e.addr + "#" + strconv.Itoa(i)), endpoint: e})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool {
+		return p.ring[i].hash < p.ring[j].hash
+	})
+	return p
+}
+
+func (p *consistentHashPicker) Pick(info grpc_balancer.PickInfo) (grpc_balancer.PickResult, error) {
+	md, _ := metadata.FromOutgoingContext(info.Ctx)
+	values := md.Get(p.hashKey)
+	if p.hashKey == "" || len(values) == 0 {
+		e := p.endpoints[p.next.Add(1)%uint64(len(p.endpoints))]
+		return grpc_balancer.PickResult{SubConn: e.subConn}, nil
+	}
+
+	hash := hashString(values[0])
+	i := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i].hash >= hash
+	})
+	if i == len(p.ring) {
+		i = 0
+	}
+	return grpc_balancer.PickResult{SubConn: p.ring[i].endpoint.subConn}, nil
+}
+
+// hashString is fnv-1a followed by the splitmix64 finalizer, fnv alone spreads similar strings poorly on the ring.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,69 @@
+package consul
+
+import (
+	"fmt"
+	"net"
+)
+
+// DetectAddress returns the IPv4 address to register. The first address within preferCIDRs wins (in the order
+// of preferCIDRs), then the first address on preferInterfaces, then the first private address, then any
+// non-loopback address.
+func DetectAddress(preferInterfaces, preferCIDRs []string) (string, error) {
+	nets := make([]*net.IPNet, 0, len(preferCIDRs))
+	for _, cidr := range preferCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return "", fmt.Errorf("invalid cidr %s: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	ipsByIface := make(map[string][]net.IP, len(ifaces))
+	var all []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ipsByIface[iface.Name] = append(ipsByIface[iface.Name], ipNet.IP)
+			all = append(all, ipNet.IP)
+		}
+	}
+	return pickAddress(all, ipsByIface, preferInterfaces, nets)
+}
+
+func pickAddress(all []net.IP, ipsByIface map[string][]net.IP, preferInterfaces []string, preferNets []*net.IPNet) (string, error) {
+	for _, ipNet := range preferNets {
+		for _, ip := range all {
+			if ipNet.Contains(ip) {
+				return ip.String(), nil
+			}
+		}
+	}
+	for _, name := range preferInterfaces {
+		if ips := ipsByIface[name]; len(ips) > 0 {
+			return ips[0].String(), nil
+		}
+	}
+	for _, ip := range all {
+		if ip.IsPrivate() {
+			return ip.String(), nil
+		}
+	}
+	if len(all) > 0 {
+		return all[0].String(), nil
+	}
+	return "", fmt.Errorf("no usable IPv4 address found")
+}
@@ -2,32 +2,85 @@ package consul
 
 import (
 	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/gw-gong/gwkit-go/grpc/balancer"
+	"github.com/gw-gong/gwkit-go/grpc/registry"
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
 	"github.com/gw-gong/gwkit-go/util/str"
 
 	consul_api "github.com/hashicorp/consul/api"
 	_ "github.com/mbobakov/grpc-consul-resolver"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
 )
 
 type AgentAddr string
 
 const DefaultConsulAgentAddr AgentAddr = "127.0.0.1:8500"
 
+const localCheckAddress = "127.0.0.1"
+
 type RegisterEntry struct {
 	ServiceName string   `json:"service_name" yaml:"service_name" mapstructure:"service_name"`
 	ServiceID   string   `json:"service_id" yaml:"service_id" mapstructure:"service_id"`
 	Tags        []string `json:"tags" yaml:"tags" mapstructure:"tags"`
+
+	// Address is the address other services dial, empty means DetectAddress(PreferInterfaces, PreferCIDRs).
+	// If the detection fails, the service is registered without address, so consul uses the agent address,
+	// and the check dials 127.0.0.1.
+	Address          string   `json:"address" yaml:"address" mapstructure:"address"`
+	PreferInterfaces []string `json:"prefer_interfaces" yaml:"prefer_interfaces" mapstructure:"prefer_interfaces"`
+	PreferCIDRs      []string `json:"prefer_cidrs" yaml:"prefer_cidrs" mapstructure:"prefer_cidrs"`
+
+	Meta    map[string]string `json:"meta" yaml:"meta" mapstructure:"meta"`
+	Weights *registry.Weights `json:"weights" yaml:"weights" mapstructure:"weights"`
+	Check   *CheckConfig      `json:"check" yaml:"check" mapstructure:"check"` // nil means a gRPC check with the defaults
+}
+
+type CheckType string
+
+const (
+	CheckTypeGRPC CheckType = "grpc"
+	CheckTypeHTTP CheckType = "http"
+	CheckTypeTCP  CheckType = "tcp"
+	CheckTypeTTL  CheckType = "ttl" // the client reports passing every TTLMs/3 until Deregister
+)
+
+type CheckConfig struct {
+	Type       CheckType `json:"type" yaml:"type" mapstructure:"type"`                      // default CheckTypeGRPC
+	HTTPPath   string    `json:"http_path" yaml:"http_path" mapstructure:"http_path"`       // default /health
+	IntervalMs int       `json:"interval_ms" yaml:"interval_ms" mapstructure:"interval_ms"` // default 10000
+	TimeoutMs  int       `json:"timeout_ms" yaml:"timeout_ms" mapstructure:"timeout_ms"`    // default 3000
+	TTLMs      int       `json:"ttl_ms" yaml:"ttl_ms" mapstructure:"ttl_ms"`                // default 15000
+	// DeregisterCriticalServiceAfterMs makes consul remove the service after it is critical that long, 0 disables it
+	DeregisterCriticalServiceAfterMs int `json:"deregister_critical_service_after_ms" yaml:"deregister_critical_service_after_ms" mapstructure:"deregister_critical_service_after_ms"`
 }
 
+const (
+	defaultCheckIntervalMs = 10000
+	defaultCheckTimeoutMs  = 3000
+	defaultCheckTTLMs      = 15000
+	defaultCheckHTTPPath   = "/health"
+)
+
 func (r *RegisterEntry) GenerateServiceID() string {
 	return str.GenerateUUID()
 }
 
 type HealthyGrpcConnEntry struct {
-	ServiceName string            `json:"service_name" yaml:"service_name" mapstructure:"service_name"`
-	Tag         string            `json:"tag" yaml:"tag" mapstructure:"tag"`
-	Opts        []grpc.DialOption `json:"-" yaml:"-" mapstructure:"-"`
+	ServiceName string `json:"service_name" yaml:"service_name" mapstructure:"service_name"`
+	Tag         string `json:"tag" yaml:"tag" mapstructure:"tag"`
+	// Policy spreads the calls over the healthy instances, default balancer.PolicyPickFirst through the consul resolver
+	Policy  balancer.Policy `json:"policy" yaml:"policy" mapstructure:"policy"`
+	HashKey string          `json:"hash_key" yaml:"hash_key" mapstructure:"hash_key"` // outgoing metadata key of balancer.PolicyConsistentHash
+
+	// Opts are applied after the options of Policy, so a service config in Opts takes precedence
+	Opts []grpc.DialOption `json:"-" yaml:"-" mapstructure:"-"`
 }
 
 type ConsulServiceStatus int
@@ -50,10 +103,32 @@ type ConsulClient interface {
 type consulClient struct {
 	client    *consul_api.Client
 	agentAddr string
+
+	heartbeatMux sync.Mutex
+	heartbeats   map[string]chan struct{} // service id -> stop chan of the ttl heartbeat
 }
 
 // NewConsulRegistry returns a Registry interface for services
 func NewConsulClient(agentAddr AgentAddr) (ConsulClient, error) {
+	return newConsulClient(agentAddr)
+}
+
+// NewConsulDiscoverer finds the instances registered in consul without dialing them, e.g. for http services.
+func NewConsulDiscoverer(agentAddr AgentAddr) (registry.Discoverer, error) {
+	return newConsulClient(agentAddr)
+}
+
+// NewResolverBuilder resolves registry.Target(service, tag) to the healthy instances registered in consul,
+// like the resolver builders of the memory and static registries.
+func NewResolverBuilder(agentAddr AgentAddr) (resolver.Builder, error) {
+	discoverer, err := newConsulClient(agentAddr)
+	if err != nil {
+		return nil, err
+	}
+	return registry.NewResolverBuilder(discoverer), nil
+}
+
+func newConsulClient(agentAddr AgentAddr) (*consulClient, error) {
 	if agentAddr == "" {
 		return nil, fmt.Errorf("agent address is required")
 	}
@@ -63,39 +138,151 @@ func NewConsulClient(agentAddr AgentAddr) (ConsulClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create consul client: %w", err)
 	}
-	return &consulClient{client: c, agentAddr: string(agentAddr)}, nil
+	return &consulClient{client: c, agentAddr: string(agentAddr), heartbeats: make(map[string]chan struct{})}, nil
 }
 
 func (r *consulClient) Register(entry *RegisterEntry, port int, useTLS bool) error {
-	check := &consul_api.AgentServiceCheck{
-		GRPC:     fmt.Sprintf("%s:%d", "127.0.0.1", port),
-		Interval: "10s",
-		Timeout:  "3s",
-		Name:     entry.ServiceName + " grpc health check",
-		Status:   consul_api.HealthPassing,
-	}
-
-	if useTLS {
-		check.GRPCUseTLS = true
-		check.TLSSkipVerify = true
+	address, checkAddress := entry.Address, entry.Address
+	if address == "" {
+		var err error
+		address, err = DetectAddress(entry.PreferInterfaces, entry.PreferCIDRs)
+		if err != nil {
+			// keep the behavior from before the detection: consul uses the agent address, the check dials locally
+			log.Warn("failed to detect service address, registering without address",
+				log.Str("service_id", entry.ServiceID), log.Err(err))
+		}
+		checkAddress = address
+		if checkAddress == "" {
+			checkAddress = localCheckAddress
+		}
 	}
 
+	checkCfg := mergeCheckCfgIntoDefault(entry.Check)
+	check := buildServiceCheck(entry, checkCfg, checkAddress, port, useTLS)
 	reg := &consul_api.AgentServiceRegistration{
-		ID:    entry.ServiceID,
-		Name:  entry.ServiceName,
-		Port:  port,
-		Tags:  entry.Tags,
-		Check: check,
+		ID:      entry.ServiceID,
+		Name:    entry.ServiceName,
+		Address: address,
+		Port:    port,
+		Tags:    entry.Tags,
+		Meta:    entry.Meta,
+		Check:   check,
+	}
+	if entry.Weights != nil {
+		reg.Weights = &consul_api.AgentWeights{Passing: entry.Weights.Passing, Warning: entry.Weights.Warning}
 	}
 
 	err := r.client.Agent().ServiceRegister(reg)
 	if err != nil {
 		return fmt.Errorf("failed to register service: %w", err)
 	}
+	if checkCfg.Type == CheckTypeTTL {
+		r.startHeartbeat(entry.ServiceID, check.CheckID, time.Duration(checkCfg.TTLMs)*time.Millisecond)
+	}
 	return nil
 }
 
+func mergeCheckCfgIntoDefault(cfg *CheckConfig) *CheckConfig {
+	c := CheckConfig{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Type == "" {
+		c.Type = CheckTypeGRPC
+	}
+	if c.HTTPPath == "" {
+		c.HTTPPath = defaultCheckHTTPPath
+	}
+	if c.IntervalMs <= 0 {
+		c.IntervalMs = defaultCheckIntervalMs
+	}
+	if c.TimeoutMs <= 0 {
+		c.TimeoutMs = defaultCheckTimeoutMs
+	}
+	if c.TTLMs <= 0 {
+		c.TTLMs = defaultCheckTTLMs
+	}
+	return &c
+}
+
+func buildServiceCheck(entry *RegisterEntry, cfg *CheckConfig, address string, port int, useTLS bool) *consul_api.AgentServiceCheck {
+	check := &consul_api.AgentServiceCheck{
+		CheckID: "service:" + entry.ServiceID,
+		Name:    fmt.Sprintf("%s %s health check", entry.ServiceName, cfg.Type),
+		Status:  consul_api.HealthPassing,
+	}
+	if cfg.DeregisterCriticalServiceAfterMs > 0 {
+		check.DeregisterCriticalServiceAfter = formatMs(cfg.DeregisterCriticalServiceAfterMs)
+	}
+	if cfg.Type == CheckTypeTTL {
+		check.TTL = formatMs(cfg.TTLMs)
+		return check
+	}
+
+	check.Interval = formatMs(cfg.IntervalMs)
+	check.Timeout = formatMs(cfg.TimeoutMs)
+	hostPort := net.JoinHostPort(address, strconv.Itoa(port))
+	switch cfg.Type {
+	case CheckTypeHTTP:
+		scheme := "http"
+		if useTLS {
+			scheme = "https"
+			check.TLSSkipVerify = true
+		}
+		check.HTTP = fmt.Sprintf("%s://%s%s", scheme, hostPort, cfg.HTTPPath)
+	case CheckTypeTCP:
+		check.TCP = hostPort
+	default:
+		check.GRPC = hostPort
+		if useTLS {
+			check.GRPCUseTLS = true
+			check.TLSSkipVerify = true
+		}
+	}
+	return check
+}
+
+func formatMs(ms int) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+// startHeartbeat reports the TTL check as passing every ttl/3 until Deregister.
+func (r *consulClient) startHeartbeat(serviceID, checkID string, ttl time.Duration) {
+	stopChan := make(chan struct{})
+	r.heartbeatMux.Lock()
+	if old, ok := r.heartbeats[serviceID]; ok {
+		close(old)
+	}
+	r.heartbeats[serviceID] = stopChan
+	r.heartbeatMux.Unlock()
+
+	go util.WithRecover(func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+				if err := r.client.Agent().UpdateTTL(checkID, "", consul_api.HealthPassing); err != nil {
+					log.Error("consul ttl heartbeat failed", log.Str("service_id", serviceID), log.Err(err))
+				}
+			}
+		}
+	})
+}
+
+func (r *consulClient) stopHeartbeat(serviceID string) {
+	r.heartbeatMux.Lock()
+	defer r.heartbeatMux.Unlock()
+	if stopChan, ok := r.heartbeats[serviceID]; ok {
+		close(stopChan)
+		delete(r.heartbeats, serviceID)
+	}
+}
+
 func (r *consulClient) Deregister(serviceID string) error {
+	r.stopHeartbeat(serviceID)
 	err := r.client.Agent().ServiceDeregister(serviceID)
 	if err != nil {
 		return fmt.Errorf("failed to deregister service: %w", err)
@@ -115,7 +302,7 @@ func (r *consulClient) GetHealthyGrpcConn(entry *HealthyGrpcConnEntry) (conn *gr
 	case ConsulServiceStatusUnknown:
 		return nil, fmt.Errorf("failed to check service %s with tag %s: %w", entry.ServiceName, entry.Tag, err)
 	case ConsulServiceStatusExists:
-		return r.newGrpcConn(entry.ServiceName, entry.Tag, entry.Opts...)
+		return r.newGrpcConn(entry)
 	case ConsulServiceStatusNotExists:
 		return nil, fmt.Errorf("healthy service %s with tag %s not found: %w", entry.ServiceName, entry.Tag, err)
 	}
@@ -133,13 +320,25 @@ func (r *consulClient) checkServiceExists(serviceName, tag string, passingOnly b
 	return ConsulServiceStatusNotExists
 }
 
-func (r *consulClient) newGrpcConn(serviceName, tag string, opts ...grpc.DialOption) (conn *grpc.ClientConn, err error) {
-	target := formatGrpcConnTarget(r.agentAddr, serviceName, tag)
-	conn, err = grpc.NewClient(target, opts...)
+// newGrpcConn dials through the consul resolver of grpc-consul-resolver, like before the policies were added.
+// The other policies need the instances behind the addresses, e.g. for the weights, so they dial through the
+// registry resolver, which watches the same healthy instances.
+func (r *consulClient) newGrpcConn(entry *HealthyGrpcConnEntry) (conn *grpc.ClientConn, err error) {
+	if entry.Policy == "" || entry.Policy == balancer.PolicyPickFirst {
+		target := formatGrpcConnTarget(r.agentAddr, entry.ServiceName, entry.Tag)
+		conn, err = grpc.NewClient(target, entry.Opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create grpc connection: %w", err)
+		}
+		return conn, nil
+	}
+
+	serviceConfig, err := balancer.ServiceConfig(entry.Policy, entry.HashKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create grpc connection: %w", err)
+		return nil, err
 	}
-	return conn, nil
+	opts := append([]grpc.DialOption{grpc.WithDefaultServiceConfig(serviceConfig)}, entry.Opts...)
+	return registry.NewGrpcConn(r, entry.ServiceName, entry.Tag, opts...)
 }
 
 func formatGrpcConnTarget(agentAddr, serviceName, tag string) string {
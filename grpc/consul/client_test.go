@@ -0,0 +1,345 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/balancer"
+	"github.com/gw-gong/gwkit-go/grpc/registry"
+
+	consul_api "github.com/hashicorp/consul/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeAgent records the agent endpoints used by Register and Deregister.
+type fakeAgent struct {
+	mux          sync.Mutex
+	registered   *consul_api.AgentServiceRegistration
+	ttlUpdates   int
+	deregistered string
+}
+
+func (f *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	path := r.URL.Path
+	switch {
+	case path == "/v1/agent/service/register":
+		reg := &consul_api.AgentServiceRegistration{}
+		if err := json.NewDecoder(r.Body).Decode(reg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.registered = reg
+	case strings.HasPrefix(path, "/v1/agent/check/update/"):
+		f.ttlUpdates++
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		f.deregistered = strings.TrimPrefix(path, "/v1/agent/service/deregister/")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeAgent) snapshot() (*consul_api.AgentServiceRegistration, int, string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.registered, f.ttlUpdates, f.deregistered
+}
+
+func newTestConsulClient(t *testing.T, handler http.Handler) ConsulClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := NewConsulClient(AgentAddr(strings.TrimPrefix(server.URL, "http://")))
+	if err != nil {
+		t.Fatalf("Expected consul client to be created, got %v", err)
+	}
+	return client
+}
+
+func TestRegisterDefaultGrpcCheck(t *testing.T) {
+	agent := &fakeAgent{}
+	client := newTestConsulClient(t, agent)
+
+	entry := &RegisterEntry{
+		ServiceName: "order",
+		ServiceID:   "order-1",
+		Tags:        []string{"v1"},
+		Address:     "10.0.0.5",
+		Meta:        map[string]string{"zone": "a"},
+		Weights:     &registry.Weights{Passing: 10, Warning: 1},
+	}
+	if err := client.Register(entry, 8080, false); err != nil {
+		t.Fatalf("Expected register to succeed, got %v", err)
+	}
+
+	reg, _, _ := agent.snapshot()
+	if reg.Address != "10.0.0.5" || reg.Port != 8080 {
+		t.Errorf("Expected address 10.0.0.5:8080, got %s:%d", reg.Address, reg.Port)
+	}
+	if reg.Meta["zone"] != "a" {
+		t.Errorf("Expected meta zone=a, got %v", reg.Meta)
+	}
+	if reg.Weights == nil || reg.Weights.Passing != 10 || reg.Weights.Warning != 1 {
+		t.Errorf("Expected weights 10/1, got %+v", reg.Weights)
+	}
+	check := reg.Check
+	if check.CheckID != "service:order-1" {
+		t.Errorf("Expected check id service:order-1, got %s", check.CheckID)
+	}
+	if check.GRPC != "10.0.0.5:8080" || check.Interval != "10s" || check.Timeout != "3s" {
+		t.Errorf("Expected grpc check on 10.0.0.5:8080 every 10s, got %+v", check)
+	}
+	if check.DeregisterCriticalServiceAfter != "" {
+		t.Errorf("Expected no deregister critical service after, got %s", check.DeregisterCriticalServiceAfter)
+	}
+}
+
+func TestRegisterFallsBackWhenDetectionFails(t *testing.T) {
+	agent := &fakeAgent{}
+	client := newTestConsulClient(t, agent)
+
+	entry := &RegisterEntry{ServiceName: "order", ServiceID: "order-1", PreferCIDRs: []string{"not-a-cidr"}}
+	if err := client.Register(entry, 8080, false); err != nil {
+		t.Fatalf("Expected register to succeed without a detected address, got %v", err)
+	}
+	reg, _, _ := agent.snapshot()
+	if reg.Address != "" || reg.Check.GRPC != "127.0.0.1:8080" {
+		t.Errorf("Expected no address and a check on 127.0.0.1:8080, got %q and %q", reg.Address, reg.Check.GRPC)
+	}
+}
+
+func TestRegisterHTTPAndTCPCheck(t *testing.T) {
+	agent := &fakeAgent{}
+	client := newTestConsulClient(t, agent)
+
+	entry := &RegisterEntry{
+		ServiceName: "web",
+		ServiceID:   "web-1",
+		Address:     "10.0.0.6",
+		Check: &CheckConfig{
+			Type:                             CheckTypeHTTP,
+			HTTPPath:                         "/ping",
+			IntervalMs:                       5000,
+			DeregisterCriticalServiceAfterMs: 60000,
+		},
+	}
+	if err := client.Register(entry, 443, true); err != nil {
+		t.Fatalf("Expected register to succeed, got %v", err)
+	}
+	reg, _, _ := agent.snapshot()
+	if reg.Check.HTTP != "https://10.0.0.6:443/ping" || !reg.Check.TLSSkipVerify {
+		t.Errorf("Expected https check on /ping, got %+v", reg.Check)
+	}
+	if reg.Check.Interval != "5s" || reg.Check.DeregisterCriticalServiceAfter != "1m0s" {
+		t.Errorf("Expected interval 5s and deregister after 1m0s, got %s and %s",
+			reg.Check.Interval, reg.Check.DeregisterCriticalServiceAfter)
+	}
+
+	entry.Check = &CheckConfig{Type: CheckTypeTCP}
+	if err := client.Register(entry, 8080, false); err != nil {
+		t.Fatalf("Expected register to succeed, got %v", err)
+	}
+	reg, _, _ = agent.snapshot()
+	if reg.Check.TCP != "10.0.0.6:8080" || reg.Check.HTTP != "" {
+		t.Errorf("Expected tcp check on 10.0.0.6:8080, got %+v", reg.Check)
+	}
+}
+
+func TestRegisterTTLHeartbeat(t *testing.T) {
+	agent := &fakeAgent{}
+	client := newTestConsulClient(t, agent)
+
+	entry := &RegisterEntry{
+		ServiceName: "worker",
+		ServiceID:   "worker-1",
+		Address:     "10.0.0.7",
+		Check:       &CheckConfig{Type: CheckTypeTTL, TTLMs: 30},
+	}
+	if err := client.Register(entry, 0, false); err != nil {
+		t.Fatalf("Expected register to succeed, got %v", err)
+	}
+	reg, _, _ := agent.snapshot()
+	if reg.Check.TTL != "30ms" || reg.Check.GRPC != "" || reg.Check.Interval != "" {
+		t.Errorf("Expected a ttl check only, got %+v", reg.Check)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, updates, _ := agent.snapshot(); updates == 0 {
+		t.Errorf("Expected ttl heartbeats, got none")
+	}
+
+	if err := client.Deregister("worker-1"); err != nil {
+		t.Fatalf("Expected deregister to succeed, got %v", err)
+	}
+	_, updates, deregistered := agent.snapshot()
+	if deregistered != "worker-1" {
+		t.Errorf("Expected worker-1 to be deregistered, got %q", deregistered)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, after, _ := agent.snapshot(); after > updates+1 {
+		t.Errorf("Expected heartbeats to stop after deregister, got %d more", after-updates)
+	}
+}
+
+func TestPickAddress(t *testing.T) {
+	public := net.ParseIP("8.8.8.8")
+	private := net.ParseIP("192.168.1.10")
+	office := net.ParseIP("10.1.2.3")
+	all := []net.IP{public, private, office}
+	ipsByIface := map[string][]net.IP{"eth0": {public}, "eth1": {private}, "tun0": {office}}
+
+	_, officeNet, _ := net.ParseCIDR("10.1.0.0/16")
+	_, privateNet, _ := net.ParseCIDR("192.168.0.0/16")
+	_, otherNet, _ := net.ParseCIDR("172.16.0.0/12")
+	cases := []struct {
+		name       string
+		ifaces     []string
+		nets       []*net.IPNet
+		expectedIP string
+	}{
+		{"cidr wins over interface", []string{"eth0"}, []*net.IPNet{officeNet}, "10.1.2.3"},
+		{"cidrs in order", []string{"eth0"}, []*net.IPNet{officeNet, privateNet}, "10.1.2.3"},
+		{"interface when no cidr matches", []string{"eth0"}, []*net.IPNet{otherNet}, "8.8.8.8"},
+		{"interface", []string{"missing", "eth0"}, nil, "8.8.8.8"},
+		{"private by default", nil, nil, "192.168.1.10"},
+	}
+	for _, c := range cases {
+		ip, err := pickAddress(all, ipsByIface, c.ifaces, c.nets)
+		if err != nil || ip != c.expectedIP {
+			t.Errorf("%s: expected %s, got %s (%v)", c.name, c.expectedIP, ip, err)
+		}
+	}
+
+	if ip, _ := pickAddress([]net.IP{public}, nil, nil, nil); ip != "8.8.8.8" {
+		t.Errorf("Expected fallback to a public address, got %s", ip)
+	}
+	if _, err := pickAddress(nil, nil, nil, nil); err == nil {
+		t.Errorf("Expected an error without addresses")
+	}
+}
+
+func TestConsulRegistry(t *testing.T) {
+	agent := &fakeAgent{}
+	reg, err := NewConsulRegistry(newTestConsulClient(t, agent), WithRegistryCheck(&CheckConfig{Type: CheckTypeTCP}))
+	if err != nil {
+		t.Fatalf("Expected a registry, got %v", err)
+	}
+
+	instance := &registry.ServiceInstance{
+		ID:      "order-1",
+		Service: "order",
+		Address: "10.0.0.8",
+		Port:    8080,
+		Meta:    map[string]string{"zone": "a"},
+		Weights: registry.Weights{Passing: 3},
+	}
+	if err := reg.Register(context.Background(), instance); err != nil {
+		t.Fatalf("Expected register to succeed, got %v", err)
+	}
+	registered, _, _ := agent.snapshot()
+	if registered.ID != "order-1" || registered.Name != "order" || registered.Meta["zone"] != "a" {
+		t.Errorf("Expected order-1 of order with meta, got %+v", registered)
+	}
+	if registered.Weights == nil || registered.Weights.Passing != 3 || registered.Check.TCP != "10.0.0.8:8080" {
+		t.Errorf("Expected passing weight 3 and a tcp check, got %+v and %+v", registered.Weights, registered.Check)
+	}
+
+	if err := reg.Deregister(context.Background(), instance); err != nil {
+		t.Fatalf("Expected deregister to succeed, got %v", err)
+	}
+	if _, _, deregistered := agent.snapshot(); deregistered != "order-1" {
+		t.Errorf("Expected order-1 to be deregistered, got %q", deregistered)
+	}
+}
+
+func TestConsulRegistryNeedsDiscovery(t *testing.T) {
+	// only the methods of ConsulClient are promoted, not Discover and Watch
+	registerOnly := struct{ ConsulClient }{newTestConsulClient(t, &fakeAgent{})}
+	if _, err := NewConsulRegistry(registerOnly); err == nil {
+		t.Errorf("Expected an error for a client without discovery")
+	}
+}
+
+func TestGetHealthyGrpcConnWithPolicy(t *testing.T) {
+	listeners := make(map[string]*bufconn.Listener)
+	var instances []*registry.ServiceInstance
+	for i, name := range []string{"a", "b"} {
+		listener := bufconn.Listen(1024 * 1024)
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("server", name))
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		defer server.Stop()
+		listeners[fmt.Sprintf("10.0.0.%d:80", i+2)] = listener
+		instances = append(instances, &registry.ServiceInstance{
+			ID: name, Address: fmt.Sprintf("10.0.0.%d", i+2), Port: 80, Tags: []string{"grpc"}, Health: consul_api.HealthPassing,
+		})
+	}
+	client := newTestConsulClient(t, newFakeHealth(instances...))
+
+	conn, err := client.GetHealthyGrpcConn(&HealthyGrpcConnEntry{
+		ServiceName: "order",
+		Tag:         "grpc",
+		Policy:      balancer.PolicyRoundRobin,
+		Opts: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return listeners[addr].DialContext(ctx)
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected connection to be created, got %v", err)
+	}
+	defer conn.Close()
+
+	healthClient := healthpb.NewHealthClient(conn)
+	seen := make(map[string]int)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(seen) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the calls to reach both instances, got %v", seen)
+		}
+		var header metadata.MD
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+		cancel()
+		if err != nil {
+			t.Fatalf("Expected the call to succeed, got %v", err)
+		}
+		seen[header.Get("server")[0]]++
+	}
+
+	pickFirst, err := client.GetHealthyGrpcConn(&HealthyGrpcConnEntry{ServiceName: "order", Tag: "grpc",
+		Opts: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}})
+	if err != nil {
+		t.Fatalf("Expected connection to be created, got %v", err)
+	}
+	defer pickFirst.Close()
+	if expected := formatGrpcConnTarget(client.(*consulClient).agentAddr, "order", "grpc"); pickFirst.Target() != expected {
+		t.Errorf("Expected the default policy to dial %s, got %s", expected, pickFirst.Target())
+	}
+
+	if _, err := client.GetHealthyGrpcConn(&HealthyGrpcConnEntry{ServiceName: "order", Tag: "grpc", Policy: "random"}); err == nil {
+		t.Errorf("Expected an error for an unknown policy")
+	}
+}
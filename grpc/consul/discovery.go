@@ -0,0 +1,86 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/registry"
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
+
+	consul_api "github.com/hashicorp/consul/api"
+)
+
+const (
+	discoveryWaitTime      = 30 * time.Second // blocking query wait time of Watch
+	discoveryRetryInterval = time.Second      // wait after a consul error in Watch
+)
+
+func (r *consulClient) Discover(ctx context.Context, service, tag string) ([]*registry.ServiceInstance, error) {
+	if service == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+	entries, _, err := r.client.Health().Service(service, tag, false, (&consul_api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover service %s: %w", service, err)
+	}
+	return toServiceInstances(entries), nil
+}
+
+func (r *consulClient) Watch(ctx context.Context, service, tag string) (<-chan []*registry.ServiceInstance, error) {
+	if service == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+	updates := make(chan []*registry.ServiceInstance, 1)
+	go util.WithRecover(func() {
+		defer close(updates)
+		var waitIndex uint64
+		for {
+			opts := (&consul_api.QueryOptions{WaitIndex: waitIndex, WaitTime: discoveryWaitTime}).WithContext(ctx)
+			entries, meta, err := r.client.Health().Service(service, tag, false, opts)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Error("consul watch service failed", log.Str("service", service), log.Str("tag", tag), log.Err(err))
+				if sleepCtx(ctx, discoveryRetryInterval) != nil {
+					return
+				}
+				continue
+			}
+			if waitIndex != 0 && meta.LastIndex == waitIndex {
+				continue // the wait time elapsed without a change
+			}
+			// the index may also go backwards, e.g. after a consul snapshot restore, it's used as is then,
+			// but it must stay above 0, otherwise the next query doesn't block
+			waitIndex = meta.LastIndex
+			if waitIndex < 1 {
+				waitIndex = 1
+			}
+			registry.SendLatest(updates, toServiceInstances(entries))
+		}
+	})
+	return updates, nil
+}
+
+func toServiceInstances(entries []*consul_api.ServiceEntry) []*registry.ServiceInstance {
+	instances := make([]*registry.ServiceInstance, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" && entry.Node != nil {
+			address = entry.Node.Address
+		}
+		instances = append(instances, &registry.ServiceInstance{
+			ID:      entry.Service.ID,
+			Service: entry.Service.Service,
+			Address: address,
+			Port:    entry.Service.Port,
+			Tags:    entry.Service.Tags,
+			Meta:    entry.Service.Meta,
+			Weights: registry.Weights{Passing: entry.Service.Weights.Passing, Warning: entry.Service.Weights.Warning},
+			Health:  entry.Checks.AggregatedStatus(),
+		})
+	}
+	return instances
+}
@@ -0,0 +1,180 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/registry"
+
+	consul_api "github.com/hashicorp/consul/api"
+)
+
+// fakeHealth emulates the health service endpoint with blocking queries.
+type fakeHealth struct {
+	mux       sync.Mutex
+	changed   chan struct{}
+	index     uint64
+	instances []*registry.ServiceInstance
+}
+
+func newFakeHealth(instances ...*registry.ServiceInstance) *fakeHealth {
+	return &fakeHealth{changed: make(chan struct{}), index: 1, instances: instances}
+}
+
+func (f *fakeHealth) set(instances ...*registry.ServiceInstance) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.instances = instances
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/v1/health/service/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	waitIndex, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+	wait, _ := time.ParseDuration(query.Get("wait"))
+	f.mux.Lock()
+	if waitIndex >= f.index {
+		changed := f.changed
+		f.mux.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		f.mux.Lock()
+	}
+	defer f.mux.Unlock()
+
+	tag := query.Get("tag")
+	entries := make([]map[string]interface{}, 0, len(f.instances))
+	for _, instance := range f.instances {
+		if tag != "" && !containsTag(instance.Tags, tag) {
+			continue
+		}
+		entries = append(entries, map[string]interface{}{
+			"Node": map[string]string{"Address": "10.0.0.1"},
+			"Service": map[string]interface{}{
+				"ID":      instance.ID,
+				"Service": strings.TrimPrefix(r.URL.Path, "/v1/health/service/"),
+				"Address": instance.Address,
+				"Port":    instance.Port,
+				"Tags":    instance.Tags,
+				"Meta":    instance.Meta,
+				"Weights": map[string]int{"Passing": instance.Weights.Passing, "Warning": instance.Weights.Warning},
+			},
+			"Checks": []map[string]string{{"Status": instance.Health}},
+		})
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	writeJSON(w, entries)
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestConsulDiscoverer(t *testing.T, handler http.Handler) registry.Discoverer {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	discoverer, err := NewConsulDiscoverer(AgentAddr(strings.TrimPrefix(server.URL, "http://")))
+	if err != nil {
+		t.Fatalf("Expected consul discoverer to be created, got %v", err)
+	}
+	return discoverer
+}
+
+func TestConsulDiscover(t *testing.T) {
+	fake := newFakeHealth(
+		&registry.ServiceInstance{ID: "a", Address: "10.0.0.2", Port: 80, Tags: []string{"v1"}, Meta: map[string]string{"zone": "a"},
+			Weights: registry.Weights{Passing: 5, Warning: 1}, Health: consul_api.HealthPassing},
+		&registry.ServiceInstance{ID: "b", Port: 81, Tags: []string{"v1"}, Health: consul_api.HealthCritical},
+		&registry.ServiceInstance{ID: "c", Address: "10.0.0.4", Port: 82, Tags: []string{"v2"}, Health: consul_api.HealthPassing},
+	)
+	client := newTestConsulDiscoverer(t, fake)
+
+	instances, err := client.Discover(context.Background(), "order", "v1")
+	if err != nil {
+		t.Fatalf("Expected discover to succeed, got %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances with tag v1, got %d", len(instances))
+	}
+	a, b := instances[0], instances[1]
+	if a.ID != "a" || a.Service != "order" || a.Address != "10.0.0.2" || a.Port != 80 || a.Meta["zone"] != "a" {
+		t.Errorf("Expected instance a of order at 10.0.0.2:80, got %+v", a)
+	}
+	if a.Weights.Passing != 5 || !a.Healthy() {
+		t.Errorf("Expected a healthy instance with passing weight 5, got %+v", a)
+	}
+	if b.Address != "10.0.0.1" {
+		t.Errorf("Expected the node address for an instance without address, got %s", b.Address)
+	}
+	if b.Healthy() || len(registry.HealthyInstances(instances)) != 1 {
+		t.Errorf("Expected b to be unhealthy, got %s", b.Health)
+	}
+}
+
+func TestConsulWatch(t *testing.T) {
+	fake := newFakeHealth(&registry.ServiceInstance{ID: "a", Address: "10.0.0.2", Port: 80, Health: consul_api.HealthPassing})
+	client := newTestConsulDiscoverer(t, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := client.Watch(ctx, "order", "")
+	if err != nil {
+		t.Fatalf("Expected watch to start, got %v", err)
+	}
+	if instances := receive(t, updates); len(instances) != 1 {
+		t.Fatalf("Expected the current instance first, got %d", len(instances))
+	}
+
+	fake.set(
+		&registry.ServiceInstance{ID: "a", Address: "10.0.0.2", Port: 80, Health: consul_api.HealthPassing},
+		&registry.ServiceInstance{ID: "b", Address: "10.0.0.3", Port: 80, Health: consul_api.HealthPassing},
+	)
+	if instances := receive(t, updates); len(instances) != 2 {
+		t.Fatalf("Expected 2 instances after the change, got %d", len(instances))
+	}
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Errorf("Expected no more updates after cancel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the updates channel to be closed after cancel")
+	}
+}
+
+func receive(t *testing.T, updates <-chan []*registry.ServiceInstance) []*registry.ServiceInstance {
+	t.Helper()
+	select {
+	case instances, ok := <-updates:
+		if !ok {
+			t.Fatalf("Expected an update, got a closed channel")
+		}
+		return instances
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected an update, got none")
+	}
+	return nil
+}
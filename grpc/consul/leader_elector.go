@@ -0,0 +1,323 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/concurrency/election"
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
+
+	consul_api "github.com/hashicorp/consul/api"
+)
+
+const (
+	defaultSessionTTLSec           = 15
+	defaultElectionRetryMs         = 5000
+	defaultElectionWaitTimeMs      = 30000
+	minConsulSessionTTLSec         = 10
+	leaderElectorSessionNamePrefix = "leader-election-"
+)
+
+type LeaderElectorConfig struct {
+	Key   string `json:"key" yaml:"key" mapstructure:"key"`
+	Value string `json:"value" yaml:"value" mapstructure:"value"` // written to the key by the leader, e.g. the hostname
+
+	SessionTTLSec int `json:"session_ttl_sec" yaml:"session_ttl_sec" mapstructure:"session_ttl_sec"` // default 15, min 10
+	// LockDelayMs is how long consul blocks the key after the session of the leader is invalidated, 0 means the consul default (15s)
+	LockDelayMs int `json:"lock_delay_ms" yaml:"lock_delay_ms" mapstructure:"lock_delay_ms"`
+	RetryMs     int `json:"retry_ms" yaml:"retry_ms" mapstructure:"retry_ms"`             // wait after a consul error, default 5000
+	WaitTimeMs  int `json:"wait_time_ms" yaml:"wait_time_ms" mapstructure:"wait_time_ms"` // blocking query wait time, default 30000
+}
+
+// consulLeaderElector holds the leadership through a consul session lock on cfg.Key. The session is renewed
+// in the background, the leadership is lost when the session expires or the key is taken by another session.
+type consulLeaderElector struct {
+	*election.LeadershipNotifier
+	client *consul_api.Client
+	cfg    LeaderElectorConfig
+
+	mux         sync.Mutex
+	sessionID   string
+	stopChan    chan struct{} // closed when the session is given up, stops the renewal which destroys the session
+	monitorStop chan struct{} // closed to stop the monitoring, nil once closed
+}
+
+func NewLeaderElector(agentAddr AgentAddr, cfg *LeaderElectorConfig) (election.LeaderElector, error) {
+	if agentAddr == "" {
+		return nil, fmt.Errorf("agent address is required")
+	}
+	if cfg == nil || cfg.Key == "" {
+		return nil, fmt.Errorf("leader election key is required")
+	}
+	c := *cfg
+	if c.SessionTTLSec <= 0 {
+		c.SessionTTLSec = defaultSessionTTLSec
+	}
+	if c.SessionTTLSec < minConsulSessionTTLSec {
+		c.SessionTTLSec = minConsulSessionTTLSec
+	}
+	if c.RetryMs <= 0 {
+		c.RetryMs = defaultElectionRetryMs
+	}
+	if c.WaitTimeMs <= 0 {
+		c.WaitTimeMs = defaultElectionWaitTimeMs
+	}
+
+	config := consul_api.DefaultConfig()
+	config.Address = string(agentAddr)
+	client, err := consul_api.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consul client: %w", err)
+	}
+	return &consulLeaderElector{
+		LeadershipNotifier: election.NewLeadershipNotifier(),
+		client:             client,
+		cfg:                c,
+	}, nil
+}
+
+func (e *consulLeaderElector) Campaign(ctx context.Context) error {
+	// Resign cancels the campaign through ctx
+	resigned := e.Resigned()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-resigned:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	stopped := func(err error) error {
+		select {
+		case <-resigned:
+			return election.ErrResigned
+		default:
+			return err
+		}
+	}
+
+	for {
+		if e.IsLeader() {
+			return nil
+		}
+		acquired, err := e.tryAcquire(ctx)
+		if err == nil && acquired {
+			if stopped(nil) != nil {
+				// Resign ran while the lock was acquired
+				_ = e.release()
+				return election.ErrResigned
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			e.giveUpSession()
+			return stopped(ctxErr)
+		}
+		if err != nil {
+			log.Error("leader election failed to acquire lock", log.Str("key", e.cfg.Key), log.Err(err))
+			if err := sleepCtx(ctx, time.Duration(e.cfg.RetryMs)*time.Millisecond); err != nil {
+				e.giveUpSession()
+				return stopped(err)
+			}
+			continue
+		}
+		if err := e.waitForRelease(ctx); err != nil {
+			e.giveUpSession()
+			return stopped(err)
+		}
+	}
+}
+
+func (e *consulLeaderElector) tryAcquire(ctx context.Context) (bool, error) {
+	sessionID, monitorStop, err := e.ensureSession()
+	if err != nil {
+		return false, err
+	}
+	pair := &consul_api.KVPair{Key: e.cfg.Key, Value: []byte(e.cfg.Value), Session: sessionID}
+	acquired, _, err := e.client.KV().Acquire(pair, (&consul_api.WriteOptions{}).WithContext(ctx))
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	if e.Set(true) {
+		log.Info("leader election won", log.Str("key", e.cfg.Key), log.Str("session", sessionID))
+	}
+	go util.WithRecover(func() {
+		e.monitor(sessionID, monitorStop)
+	})
+	return true, nil
+}
+
+// ensureSession creates the session on first use and renews it until it is given up.
+func (e *consulLeaderElector) ensureSession() (string, chan struct{}, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.sessionID != "" {
+		return e.sessionID, e.monitorStop, nil
+	}
+
+	ttl := fmt.Sprintf("%ds", e.cfg.SessionTTLSec)
+	sessionID, _, err := e.client.Session().Create(&consul_api.SessionEntry{
+		Name:      leaderElectorSessionNamePrefix + e.cfg.Key,
+		TTL:       ttl,
+		Behavior:  consul_api.SessionBehaviorRelease,
+		LockDelay: time.Duration(e.cfg.LockDelayMs) * time.Millisecond,
+	}, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	stopChan, monitorStop := make(chan struct{}), make(chan struct{})
+	e.sessionID = sessionID
+	e.stopChan = stopChan
+	e.monitorStop = monitorStop
+
+	go util.WithRecover(func() {
+		// destroys the session when stopChan is closed
+		err := e.client.Session().RenewPeriodic(ttl, sessionID, nil, stopChan)
+		if err != nil {
+			log.Warn("leader election session expired", log.Str("key", e.cfg.Key), log.Str("session", sessionID), log.Err(err))
+			e.lose(sessionID)
+		}
+	})
+	return sessionID, monitorStop, nil
+}
+
+// monitor watches the key with blocking queries and drops the leadership once the key is no longer held by the session.
+func (e *consulLeaderElector) monitor(sessionID string, monitorStop chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-monitorStop
+		cancel()
+	}()
+
+	var waitIndex uint64
+	for {
+		opts := (&consul_api.QueryOptions{
+			WaitIndex: waitIndex,
+			WaitTime:  time.Duration(e.cfg.WaitTimeMs) * time.Millisecond,
+		}).WithContext(ctx)
+		pair, meta, err := e.client.KV().Get(e.cfg.Key, opts)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error("leader election failed to watch lock", log.Str("key", e.cfg.Key), log.Err(err))
+			if sleepCtx(ctx, time.Duration(e.cfg.RetryMs)*time.Millisecond) != nil {
+				return
+			}
+			continue
+		}
+		if pair == nil || pair.Session != sessionID {
+			e.lose(sessionID)
+			return
+		}
+		waitIndex = meta.LastIndex
+	}
+}
+
+// waitForRelease blocks until the key has no holder.
+func (e *consulLeaderElector) waitForRelease(ctx context.Context) error {
+	var waitIndex uint64
+	for {
+		opts := (&consul_api.QueryOptions{
+			WaitIndex: waitIndex,
+			WaitTime:  time.Duration(e.cfg.WaitTimeMs) * time.Millisecond,
+		}).WithContext(ctx)
+		pair, meta, err := e.client.KV().Get(e.cfg.Key, opts)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			log.Error("leader election failed to watch lock", log.Str("key", e.cfg.Key), log.Err(err))
+			return sleepCtx(ctx, time.Duration(e.cfg.RetryMs)*time.Millisecond)
+		}
+		if pair == nil || pair.Session == "" {
+			if waitIndex == 0 {
+				// the key was free but the acquire failed, e.g. because of the lock delay
+				return sleepCtx(ctx, time.Duration(e.cfg.RetryMs)*time.Millisecond)
+			}
+			return nil
+		}
+		waitIndex = meta.LastIndex
+	}
+}
+
+func (e *consulLeaderElector) Resign() error {
+	e.NotifyResigned()
+	return e.release()
+}
+
+// release gives up the leadership: the monitoring is stopped first, so the release is not reported as a lost
+// leadership, and the lock is released before the session is destroyed, so the two don't race.
+func (e *consulLeaderElector) release() error {
+	e.mux.Lock()
+	sessionID := e.sessionID
+	e.stopMonitorLocked()
+	e.mux.Unlock()
+
+	var err error
+	if sessionID != "" {
+		pair := &consul_api.KVPair{Key: e.cfg.Key, Session: sessionID}
+		if _, _, releaseErr := e.client.KV().Release(pair, nil); releaseErr != nil {
+			err = fmt.Errorf("failed to release lock: %w", releaseErr)
+		}
+	}
+	e.giveUpSession()
+	if e.Set(false) {
+		log.Info("leader election resigned", log.Str("key", e.cfg.Key), log.Str("session", sessionID))
+	}
+	return err
+}
+
+// lose drops the leadership if sessionID is still the current session.
+func (e *consulLeaderElector) lose(sessionID string) {
+	e.mux.Lock()
+	if e.sessionID != sessionID {
+		e.mux.Unlock()
+		return
+	}
+	e.sessionID = ""
+	close(e.stopChan)
+	e.stopMonitorLocked()
+	e.mux.Unlock()
+
+	if e.Set(false) {
+		log.Warn("leader election lost leadership", log.Str("key", e.cfg.Key), log.Str("session", sessionID))
+	}
+}
+
+// giveUpSession stops the renewal, which destroys the session and releases the key. It returns the given up session.
+func (e *consulLeaderElector) giveUpSession() string {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	sessionID := e.sessionID
+	if sessionID != "" {
+		e.sessionID = ""
+		close(e.stopChan)
+		e.stopMonitorLocked()
+	}
+	return sessionID
+}
+
+func (e *consulLeaderElector) stopMonitorLocked() {
+	if e.monitorStop != nil {
+		close(e.monitorStop)
+		e.monitorStop = nil
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
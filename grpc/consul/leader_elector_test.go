@@ -0,0 +1,264 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/concurrency/election"
+)
+
+// fakeConsul emulates the session and kv lock endpoints used by the leader elector.
+type fakeConsul struct {
+	mux      sync.Mutex
+	changed  chan struct{} // closed and replaced on every kv change, wakes up blocking queries
+	index    uint64
+	sessions map[string]bool
+	nextID   int
+	holder   string // session holding the key
+	value    []byte
+	exists   bool
+	ops      []string // release and destroy calls with their session, in order
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{changed: make(chan struct{}), index: 1, sessions: make(map[string]bool)}
+}
+
+func (f *fakeConsul) bumpLocked() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// invalidate emulates an expired session, the lock is released like with the release behavior.
+func (f *fakeConsul) invalidate(sessionID string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	delete(f.sessions, sessionID)
+	if f.holder == sessionID {
+		f.holder = ""
+		f.bumpLocked()
+	}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	query := r.URL.Query()
+	switch {
+	case path == "/v1/session/create":
+		f.mux.Lock()
+		f.nextID++
+		id := fmt.Sprintf("session-%d", f.nextID)
+		f.sessions[id] = true
+		f.mux.Unlock()
+		writeJSON(w, map[string]string{"ID": id})
+
+	case strings.HasPrefix(path, "/v1/session/renew/"):
+		id := strings.TrimPrefix(path, "/v1/session/renew/")
+		f.mux.Lock()
+		ok := f.sessions[id]
+		f.mux.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, []map[string]string{{"ID": id, "TTL": "10s"}})
+
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		f.mux.Lock()
+		id := strings.TrimPrefix(path, "/v1/session/destroy/")
+		f.ops = append(f.ops, "destroy "+id)
+		f.mux.Unlock()
+		f.invalidate(id)
+		writeJSON(w, true)
+
+	case strings.HasPrefix(path, "/v1/kv/") && r.Method == http.MethodPut:
+		f.mux.Lock()
+		defer f.mux.Unlock()
+		switch {
+		case query.Get("acquire") != "":
+			session := query.Get("acquire")
+			if !f.sessions[session] || (f.holder != "" && f.holder != session) {
+				writeJSON(w, false)
+				return
+			}
+			value, _ := io.ReadAll(r.Body)
+			f.holder, f.value, f.exists = session, value, true
+			f.bumpLocked()
+			writeJSON(w, true)
+		case query.Get("release") != "":
+			f.ops = append(f.ops, "release "+query.Get("release"))
+			if f.holder != query.Get("release") {
+				writeJSON(w, false)
+				return
+			}
+			f.holder = ""
+			f.bumpLocked()
+			writeJSON(w, true)
+		}
+
+	case strings.HasPrefix(path, "/v1/kv/") && r.Method == http.MethodGet:
+		waitIndex, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+		wait, _ := time.ParseDuration(query.Get("wait"))
+		f.mux.Lock()
+		if waitIndex >= f.index {
+			changed := f.changed
+			f.mux.Unlock()
+			select {
+			case <-changed:
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return
+			}
+			f.mux.Lock()
+		}
+		defer f.mux.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		if !f.exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, []map[string]interface{}{{
+			"Key":         strings.TrimPrefix(path, "/v1/kv/"),
+			"Value":       f.value,
+			"Session":     f.holder,
+			"ModifyIndex": f.index,
+		}})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func waitForChange(t *testing.T, changes <-chan bool, expected bool) {
+	t.Helper()
+	select {
+	case leader := <-changes:
+		if leader != expected {
+			t.Fatalf("Expected leadership change to %v, got %v", expected, leader)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected leadership change to %v, got none", expected)
+	}
+}
+
+func TestConsulLeaderElector(t *testing.T) {
+	fake := newFakeConsul()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := &LeaderElectorConfig{Key: "service/leader", RetryMs: 10, WaitTimeMs: 200}
+	addr := AgentAddr(strings.TrimPrefix(server.URL, "http://"))
+	a, err := NewLeaderElector(addr, cfg)
+	if err != nil {
+		t.Fatalf("Expected elector to be created, got %v", err)
+	}
+	b, _ := NewLeaderElector(addr, cfg)
+
+	if err := a.Campaign(context.Background()); err != nil {
+		t.Fatalf("Expected a to win the election, got %v", err)
+	}
+	waitForChange(t, a.Changes(), true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Campaign(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected b to wait while a is the leader, got %v", err)
+	}
+
+	campaignErr := make(chan error, 1)
+	go func() {
+		campaignErr <- b.Campaign(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := a.Resign(); err != nil {
+		t.Fatalf("Expected a to resign, got %v", err)
+	}
+	waitForChange(t, a.Changes(), false)
+	if err := <-campaignErr; err != nil {
+		t.Fatalf("Expected b to win after a resigned, got %v", err)
+	}
+	waitForChange(t, b.Changes(), true)
+
+	fake.mux.Lock()
+	holder := fake.holder
+	fake.mux.Unlock()
+	fake.invalidate(holder)
+	waitForChange(t, b.Changes(), false)
+	if b.IsLeader() {
+		t.Errorf("Expected b to lose the leadership after its session was invalidated")
+	}
+}
+
+func TestConsulLeaderElectorResign(t *testing.T) {
+	fake := newFakeConsul()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := &LeaderElectorConfig{Key: "service/leader", RetryMs: 10, WaitTimeMs: 200}
+	addr := AgentAddr(strings.TrimPrefix(server.URL, "http://"))
+	a, _ := NewLeaderElector(addr, cfg)
+	b, _ := NewLeaderElector(addr, cfg)
+	if err := a.Campaign(context.Background()); err != nil {
+		t.Fatalf("Expected a to win the election, got %v", err)
+	}
+
+	campaignErr := make(chan error, 1)
+	go func() {
+		campaignErr <- b.Campaign(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = b.Resign()
+	select {
+	case err := <-campaignErr:
+		if !errors.Is(err, election.ErrResigned) {
+			t.Errorf("Expected ErrResigned, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected Resign to stop the campaign of b")
+	}
+
+	fake.mux.Lock()
+	holder := fake.holder
+	fake.mux.Unlock()
+	if err := a.Resign(); err != nil {
+		t.Fatalf("Expected a to resign, got %v", err)
+	}
+	// the renewal stops asynchronously, wait for the session to be destroyed
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var ops []string
+		fake.mux.Lock()
+		for _, op := range fake.ops {
+			if strings.HasSuffix(op, " "+holder) {
+				ops = append(ops, strings.TrimSuffix(op, " "+holder))
+			}
+		}
+		fake.mux.Unlock()
+		if len(ops) == 2 {
+			if ops[0] != "release" || ops[1] != "destroy" {
+				t.Errorf("Expected the lock to be released before the session is destroyed, got %v", ops)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected release and destroy, got %v", ops)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
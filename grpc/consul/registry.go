@@ -0,0 +1,81 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gw-gong/gwkit-go/grpc/registry"
+)
+
+type registryOption func(r *consulRegistry)
+
+// WithRegistryCheck sets the health check of the registered instances, the default is a gRPC check.
+func WithRegistryCheck(check *CheckConfig) registryOption {
+	return func(r *consulRegistry) {
+		r.check = check
+	}
+}
+
+// WithRegistryTLS makes the gRPC and http checks use tls.
+func WithRegistryTLS(useTLS bool) registryOption {
+	return func(r *consulRegistry) {
+		r.useTLS = useTLS
+	}
+}
+
+// consulRegistry adapts ConsulClient to registry.Registry.
+type consulRegistry struct {
+	client     ConsulClient
+	discoverer registry.Discoverer
+	check      *CheckConfig
+	useTLS     bool
+}
+
+// NewConsulRegistry returns client as registry.Registry, dial its services with registry.NewGrpcConn.
+// client must also be a registry.Discoverer, like the clients of NewConsulClient.
+func NewConsulRegistry(client ConsulClient, opts ...registryOption) (registry.Registry, error) {
+	discoverer, ok := client.(registry.Discoverer)
+	if !ok {
+		return nil, fmt.Errorf("consul client %T does not support discovery", client)
+	}
+	r := &consulRegistry{client: client, discoverer: discoverer}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// Register registers instance with ConsulClient.Register, an empty instance.Address is detected.
+func (r *consulRegistry) Register(ctx context.Context, instance *registry.ServiceInstance) error {
+	if instance == nil {
+		return fmt.Errorf("instance is nil")
+	}
+	entry := &RegisterEntry{
+		ServiceName: instance.Service,
+		ServiceID:   instance.ID,
+		Tags:        instance.Tags,
+		Address:     instance.Address,
+		Meta:        instance.Meta,
+		Check:       r.check,
+	}
+	if instance.Weights.Passing > 0 || instance.Weights.Warning > 0 {
+		weights := instance.Weights
+		entry.Weights = &weights
+	}
+	return r.client.Register(entry, instance.Port, r.useTLS)
+}
+
+func (r *consulRegistry) Deregister(ctx context.Context, instance *registry.ServiceInstance) error {
+	if instance == nil {
+		return fmt.Errorf("instance is nil")
+	}
+	return r.client.Deregister(instance.ID)
+}
+
+func (r *consulRegistry) Discover(ctx context.Context, service, tag string) ([]*registry.ServiceInstance, error) {
+	return r.discoverer.Discover(ctx, service, tag)
+}
+
+func (r *consulRegistry) Watch(ctx context.Context, service, tag string) (<-chan []*registry.ServiceInstance, error) {
+	return r.discoverer.Watch(ctx, service, tag)
+}
@@ -0,0 +1,138 @@
+package errcode
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gw-gong/gwkit-go/http/code"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ErrorInfoReason = "BUSINESS_ERROR"
+	ErrorInfoDomain = "gwkit-go"
+
+	metaKeyCode       = "code"
+	metaKeyHttpStatus = "http_status"
+)
+
+// StatusError is a decoded business error, errors.As finds both the *code.ErrCode and the gRPC status.
+type StatusError struct {
+	ErrCode *code.ErrCode
+	status  *status.Status
+}
+
+func (e *StatusError) Error() string {
+	return e.ErrCode.Msg
+}
+
+func (e *StatusError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.ErrCode
+}
+
+// ToStatus encodes ec into the details of a gRPC status, the gRPC code is derived from ec.HttpStatus,
+// or from the client/server class of ec.Code when the http status is 200.
+func ToStatus(ec *code.ErrCode) *status.Status {
+	if ec == nil || ec.Code == code.Success.Code {
+		return status.New(codes.OK, "")
+	}
+	s := status.New(grpcCode(ec), ec.Msg)
+	detailed, err := s.WithDetails(&errdetails.ErrorInfo{
+		Reason: ErrorInfoReason,
+		Domain: ErrorInfoDomain,
+		Metadata: map[string]string{
+			metaKeyCode:       strconv.Itoa(ec.Code),
+			metaKeyHttpStatus: strconv.Itoa(ec.HttpStatus),
+		},
+	})
+	if err != nil {
+		return s
+	}
+	return detailed
+}
+
+// Error returns ec as a gRPC status error, nil for nil or code.Success.
+func Error(ec *code.ErrCode) error {
+	return ToStatus(ec).Err()
+}
+
+// FromError decodes the business error carried by err, which is a *code.ErrCode, a *StatusError,
+// or a gRPC status error from ToStatus. It returns false for other errors.
+func FromError(err error) (*code.ErrCode, bool) {
+	if err == nil {
+		return nil, false
+	}
+	var ec *code.ErrCode
+	if errors.As(err, &ec) {
+		return ec, true
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+	return FromStatus(s)
+}
+
+func FromStatus(s *status.Status) (*code.ErrCode, bool) {
+	for _, detail := range s.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Reason != ErrorInfoReason || info.Domain != ErrorInfoDomain {
+			continue
+		}
+		c, err := strconv.Atoi(info.Metadata[metaKeyCode])
+		if err != nil {
+			continue
+		}
+		httpStatus, err := strconv.Atoi(info.Metadata[metaKeyHttpStatus])
+		if err != nil {
+			httpStatus = http.StatusOK
+		}
+		return code.NewErrCode(c, s.Message(), httpStatus), true
+	}
+	return nil, false
+}
+
+// Decode returns err with its business error attached as a *StatusError, or err itself if there is none.
+func Decode(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	ec, ok := FromStatus(s)
+	if !ok {
+		return err
+	}
+	return &StatusError{ErrCode: ec, status: s}
+}
+
+var httpStatusToGrpcCode = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// grpcCode follows the layout [1 client/server][2 service][3 module][3 error] of code.ErrCode.
+func grpcCode(ec *code.ErrCode) codes.Code {
+	if c, ok := httpStatusToGrpcCode[ec.HttpStatus]; ok {
+		return c
+	}
+	if ec.Code/100000000 == 1 {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
@@ -0,0 +1,52 @@
+package errcode
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/http/code"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrCodeRoundTrip(t *testing.T) {
+	ec := code.NewErrCode(101002003, "order not found", http.StatusOK)
+	err := Error(ec)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected a client error to map to FailedPrecondition, got %v", status.Code(err))
+	}
+
+	// what the client receives: the status is rebuilt from its proto form
+	received := status.FromProto(status.Convert(err).Proto()).Err()
+	decoded := Decode(received)
+
+	var got *code.ErrCode
+	if !errors.As(decoded, &got) {
+		t.Fatalf("Expected a *code.ErrCode, got %v", decoded)
+	}
+	if got.Code != ec.Code || got.Msg != ec.Msg || got.HttpStatus != ec.HttpStatus {
+		t.Errorf("Expected %+v, got %+v", ec, got)
+	}
+	if status.Code(decoded) != codes.FailedPrecondition {
+		t.Errorf("Expected the decoded error to keep the gRPC status, got %v", status.Code(decoded))
+	}
+
+	if status.Code(Error(code.ErrFeatureDisabled)) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for a client error with http status 200")
+	}
+	if status.Code(Error(code.ErrTooManyRequests)) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted for http status 429")
+	}
+	if status.Code(Error(code.NewErrCode(200000001, "db", http.StatusServiceUnavailable))) != codes.Unavailable {
+		t.Errorf("Expected the http status to decide the gRPC code")
+	}
+	if Error(code.Success) != nil {
+		t.Errorf("Expected code.Success to be no error")
+	}
+	if _, ok := FromError(io.EOF); ok {
+		t.Errorf("Expected plain errors to carry no business code")
+	}
+}
@@ -0,0 +1,220 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util/str"
+
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultMaxPayloadBytes = 1024 // 1KB
+	redactedValue          = "***"
+)
+
+var defaultSkipMethods = []string{
+	"/grpc.health.v1.Health/Check",
+	"/grpc.health.v1.Health/Watch",
+}
+
+type Config struct {
+	// LogPayload logs the request and response messages as json, truncated to MaxPayloadBytes
+	LogPayload      bool `json:"log_payload" yaml:"log_payload" mapstructure:"log_payload"`
+	MaxPayloadBytes int  `json:"max_payload_bytes" yaml:"max_payload_bytes" mapstructure:"max_payload_bytes"`
+	// RedactFields are json field names (proto names, case insensitive) whose values are replaced by "***" in payloads,
+	// at any depth and including object and array values. Payloads that are not json are not logged then.
+	RedactFields []string `json:"redact_fields" yaml:"redact_fields" mapstructure:"redact_fields"`
+
+	// SkipMethods are full method names that are not logged, default the health check methods
+	SkipMethods []string `json:"skip_methods" yaml:"skip_methods" mapstructure:"skip_methods"`
+
+	Level        log.LoggerLevel            `json:"level" yaml:"level" mapstructure:"level"`                   // default info
+	ErrorLevel   log.LoggerLevel            `json:"error_level" yaml:"error_level" mapstructure:"error_level"` // level of failed calls, default warn
+	MethodLevels map[string]log.LoggerLevel `json:"method_levels" yaml:"method_levels" mapstructure:"method_levels"`
+
+	// Redact, if set, is applied to the payloads after RedactFields
+	Redact func(payload string) string `json:"-" yaml:"-" mapstructure:"-"`
+}
+
+// AccessLogger is shared by the server and client access log interceptors.
+type AccessLogger struct {
+	cfg          Config
+	skipMethods  map[string]struct{}
+	redactFields map[string]struct{} // lower case
+}
+
+type Entry struct {
+	Method   string
+	Peer     string
+	Err      error
+	Latency  time.Duration
+	ReqSize  int
+	RespSize int
+	Req      interface{} // nil for streams
+	Resp     interface{}
+}
+
+func NewAccessLogger(cfg *Config) *AccessLogger {
+	c := Config{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.MaxPayloadBytes <= 0 {
+		c.MaxPayloadBytes = defaultMaxPayloadBytes
+	}
+	if c.SkipMethods == nil {
+		c.SkipMethods = defaultSkipMethods
+	}
+	if c.Level == "" {
+		c.Level = log.LoggerLevelInfo
+	}
+	if c.ErrorLevel == "" {
+		c.ErrorLevel = log.LoggerLevelWarn
+	}
+
+	l := &AccessLogger{cfg: c, skipMethods: make(map[string]struct{}, len(c.SkipMethods))}
+	for _, method := range c.SkipMethods {
+		l.skipMethods[method] = struct{}{}
+	}
+	if len(c.RedactFields) > 0 {
+		l.redactFields = make(map[string]struct{}, len(c.RedactFields))
+		for _, field := range c.RedactFields {
+			l.redactFields[strings.ToLower(field)] = struct{}{}
+		}
+	}
+	return l
+}
+
+func (l *AccessLogger) Skip(method string) bool {
+	_, ok := l.skipMethods[method]
+	return ok
+}
+
+func (l *AccessLogger) Log(ctx context.Context, msg string, entry *Entry) {
+	fields := []log.Field{
+		log.Str("method", entry.Method),
+		log.Str("peer", entry.Peer),
+		log.Str("code", status.Code(entry.Err).String()),
+		log.Duration("latency", entry.Latency),
+		log.Int("req_size", entry.ReqSize),
+		log.Int("resp_size", entry.RespSize),
+	}
+	if entry.Err != nil {
+		fields = append(fields, log.Err(entry.Err))
+	}
+	if l.cfg.LogPayload {
+		if entry.Req != nil {
+			fields = append(fields, log.Str("req", l.Payload(entry.Req)))
+		}
+		if entry.Resp != nil {
+			fields = append(fields, log.Str("resp", l.Payload(entry.Resp)))
+		}
+	}
+
+	level := l.cfg.Level
+	if methodLevel, ok := l.cfg.MethodLevels[entry.Method]; ok {
+		level = methodLevel
+	}
+	if entry.Err != nil && log.MapLoggerLevel(l.cfg.ErrorLevel) > log.MapLoggerLevel(level) {
+		level = l.cfg.ErrorLevel
+	}
+	switch level {
+	case log.LoggerLevelDebug:
+		log.Debugc(ctx, msg, fields...)
+	case log.LoggerLevelWarn:
+		log.Warnc(ctx, msg, fields...)
+	case log.LoggerLevelError:
+		log.Errorc(ctx, msg, fields...)
+	default:
+		log.Infoc(ctx, msg, fields...)
+	}
+}
+
+// Payload formats a message as json, redacts and truncates it. Messages that can not be formatted as json are
+// formatted with %+v, or not logged at all when RedactFields is set.
+func (l *AccessLogger) Payload(msg interface{}) string {
+	var payload string
+	if pm, ok := msg.(proto.Message); ok {
+		b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(pm)
+		if err != nil {
+			return "failed to marshal payload"
+		}
+		payload = string(b)
+	} else if b, err := json.Marshal(msg); err == nil {
+		payload = string(b)
+	} else {
+		payload = fmt.Sprintf("%+v", msg)
+	}
+	if l.redactFields != nil {
+		redacted, err := l.redact(payload)
+		if err != nil {
+			return "failed to redact payload"
+		}
+		payload = redacted
+	}
+	if l.cfg.Redact != nil {
+		payload = l.cfg.Redact(payload)
+	}
+	return str.SubStringByByte(payload, l.cfg.MaxPayloadBytes)
+}
+
+// redact replaces the whole value of every RedactFields key in the json payload, the keys come out sorted.
+func (l *AccessLogger) redact(payload string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(l.redactValue(v)); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func (l *AccessLogger) redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if _, ok := l.redactFields[strings.ToLower(key)]; ok {
+				value[key] = redactedValue
+			} else {
+				value[key] = l.redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = l.redactValue(item)
+		}
+	}
+	return v
+}
+
+// Size is the wire size of a proto message, 0 for other messages.
+func Size(msg interface{}) int {
+	if pm, ok := msg.(proto.Message); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
+
+func PeerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package accesslog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/log"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// observeLogs replaces the global logger with one that records every entry until the test ends.
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zapcore.DebugLevel)
+	t.Cleanup(zap.ReplaceGlobals(zap.New(core)))
+	return logs
+}
+
+func TestPayloadRedactsAndTruncates(t *testing.T) {
+	l := NewAccessLogger(&Config{
+		LogPayload:      true,
+		MaxPayloadBytes: 20,
+		RedactFields:    []string{"Service"},
+	})
+	payload := l.Payload(&healthpb.HealthCheckRequest{Service: "secret-service-name"})
+	if strings.Contains(payload, "secret") {
+		t.Errorf("Expected the service field to be redacted, got %s", payload)
+	}
+	if len(payload) > 20 {
+		t.Errorf("Expected the payload to be truncated to 20 bytes, got %d", len(payload))
+	}
+
+	if !l.Skip("/grpc.health.v1.Health/Check") {
+		t.Errorf("Expected health checks to be skipped by default")
+	}
+	if Size(&healthpb.HealthCheckRequest{Service: "abc"}) != 5 {
+		t.Errorf("Expected the wire size of the message")
+	}
+}
+
+func TestPayloadRedactsNestedValues(t *testing.T) {
+	l := NewAccessLogger(&Config{LogPayload: true, RedactFields: []string{"password", "Card"}})
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"user": map[string]interface{}{"name": "bob", "password": "secret-1"},
+		"card": map[string]interface{}{"number": "secret-2", "cvv": "secret-3"},
+		"accounts": []interface{}{
+			map[string]interface{}{"id": "a1", "password": "secret-4"},
+			map[string]interface{}{"id": "a2", "card": []interface{}{"secret-5", "secret-6"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected a valid struct, got %v", err)
+	}
+
+	payload := l.Payload(msg)
+	if strings.Contains(payload, "secret") {
+		t.Errorf("Expected every nested value to be redacted, got %s", payload)
+	}
+	for _, kept := range []string{`"name":"bob"`, `"id":"a1"`, `"id":"a2"`, `"card":"***"`, `"password":"***"`} {
+		if !strings.Contains(payload, kept) {
+			t.Errorf("Expected %s in the payload, got %s", kept, payload)
+		}
+	}
+}
+
+func TestPayloadOfNonProtoMessages(t *testing.T) {
+	l := NewAccessLogger(&Config{LogPayload: true, RedactFields: []string{"token"}})
+	payload := l.Payload(map[string]interface{}{"items": []interface{}{map[string]interface{}{"token": []int{1, 2}}}})
+	if payload != `{"items":[{"token":"***"}]}` {
+		t.Errorf("Expected the nested token to be redacted, got %s", payload)
+	}
+	if payload := l.Payload(func() {}); strings.Contains(payload, "0x") {
+		t.Errorf("Expected a message that is not json not to be logged, got %s", payload)
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	logs := observeLogs(t)
+	l := NewAccessLogger(&Config{
+		Level:        log.LoggerLevelDebug,
+		MethodLevels: map[string]log.LoggerLevel{"/order.Order/Create": log.LoggerLevelInfo},
+	})
+
+	errCall := errors.New("call failed")
+	cases := []struct {
+		entry *Entry
+		want  zapcore.Level
+	}{
+		{&Entry{Method: "/order.Order/Get"}, zapcore.DebugLevel},
+		{&Entry{Method: "/order.Order/Create"}, zapcore.InfoLevel},
+		{&Entry{Method: "/order.Order/Get", Err: errCall}, zapcore.WarnLevel},
+	}
+	for _, c := range cases {
+		l.Log(context.Background(), "grpc server call", c.entry)
+	}
+
+	entries := logs.TakeAll()
+	if len(entries) != len(cases) {
+		t.Fatalf("Expected %d log entries, got %d", len(cases), len(entries))
+	}
+	for i, c := range cases {
+		if entries[i].Level != c.want {
+			t.Errorf("Expected %s at %s, got %s", c.entry.Method, c.want, entries[i].Level)
+		}
+	}
+}
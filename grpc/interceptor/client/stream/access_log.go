@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/accesslog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// loggingClientStream logs the stream once RecvMsg returns an error, io.EOF counts as success.
+// Streams that are abandoned before being read to the end are not logged.
+type loggingClientStream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	logger   *accesslog.AccessLogger
+	method   string
+	start    time.Time
+	peer     *peer.Peer
+	once     sync.Once
+	mux      sync.Mutex
+	reqSize  int
+	respSize int
+}
+
+func (s *loggingClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.mux.Lock()
+		s.reqSize += accesslog.Size(m)
+		s.mux.Unlock()
+	}
+	return err
+}
+
+func (s *loggingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.mux.Lock()
+		s.respSize += accesslog.Size(m)
+		s.mux.Unlock()
+		return nil
+	}
+	s.once.Do(func() {
+		logErr := err
+		if errors.Is(err, io.EOF) {
+			logErr = nil
+		}
+		s.mux.Lock()
+		entry := &accesslog.Entry{
+			Method:   s.method,
+			Err:      logErr,
+			Latency:  time.Since(s.start),
+			ReqSize:  s.reqSize,
+			RespSize: s.respSize,
+		}
+		s.mux.Unlock()
+		if s.peer.Addr != nil {
+			entry.Peer = s.peer.Addr.String()
+		}
+		s.logger.Log(s.ctx, "grpc client stream", entry)
+	})
+	return err
+}
+
+func AccessLog(cfg *accesslog.Config) grpc.StreamClientInterceptor {
+	logger := accesslog.NewAccessLogger(cfg)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if logger.Skip(method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		p := &peer.Peer{}
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, append(opts, grpc.Peer(p))...)
+		if err != nil {
+			logger.Log(ctx, "grpc client stream", &accesslog.Entry{Method: method, Err: err, Latency: time.Since(start)})
+			return nil, err
+		}
+		return &loggingClientStream{
+			ClientStream: cs,
+			ctx:          ctx,
+			logger:       logger,
+			method:       method,
+			start:        start,
+			peer:         p,
+		}, nil
+	}
+}
@@ -0,0 +1,28 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/grpc/errcode"
+
+	"google.golang.org/grpc"
+)
+
+type errCodeClientStream struct {
+	grpc.ClientStream
+}
+
+func (s *errCodeClientStream) RecvMsg(m interface{}) error {
+	return errcode.Decode(s.ClientStream.RecvMsg(m))
+}
+
+// DecodeErrCode turns status errors carrying a business code into *errcode.StatusError.
+func DecodeErrCode() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, errcode.Decode(err)
+		}
+		return &errCodeClientStream{ClientStream: cs}, nil
+	}
+}
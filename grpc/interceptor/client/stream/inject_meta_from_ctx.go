@@ -0,0 +1,29 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/util/trace"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func InjectMetaFromCtx() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, ok := metadata.FromOutgoingContext(ctx)
+		if ok {
+			md = md.Copy()
+		} else {
+			md = metadata.New(map[string]string{})
+		}
+		if requestID := trace.GetRequestIDFromCtx(ctx); requestID != "" {
+			md.Set(trace.LoggerFieldRequestID, requestID)
+		}
+		if traceID := trace.GetTraceIDFromCtx(ctx); traceID != "" {
+			md.Set(trace.LoggerFieldTraceID, traceID)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
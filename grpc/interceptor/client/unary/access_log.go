@@ -0,0 +1,40 @@
+package unary
+
+import (
+	"context"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/accesslog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+func AccessLog(cfg *accesslog.Config) grpc.UnaryClientInterceptor {
+	logger := accesslog.NewAccessLogger(cfg)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if logger.Skip(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		var p peer.Peer
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+
+		entry := &accesslog.Entry{
+			Method:  method,
+			Err:     err,
+			Latency: time.Since(start),
+			ReqSize: accesslog.Size(req),
+			Req:     req,
+		}
+		if p.Addr != nil {
+			entry.Peer = p.Addr.String()
+		}
+		if err == nil {
+			entry.RespSize = accesslog.Size(reply)
+			entry.Resp = reply
+		}
+		logger.Log(ctx, "grpc client call", entry)
+		return err
+	}
+}
@@ -0,0 +1,63 @@
+package unary
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/accesslog"
+	"github.com/gw-gong/gwkit-go/log"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	interceptor := AccessLog(&accesslog.Config{
+		LogPayload:   true,
+		RedactFields: []string{"service"},
+		Level:        log.LoggerLevelDebug,
+		MethodLevels: map[string]log.LoggerLevel{"/order.Order/Create": log.LoggerLevelInfo},
+		ErrorLevel:   log.LoggerLevelError,
+	})
+	call := func(method string, err error) {
+		req := &healthpb.HealthCheckRequest{Service: "secret"}
+		reply := &healthpb.HealthCheckResponse{}
+		_ = interceptor(context.Background(), method, req, reply, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+			return err
+		})
+	}
+	call("/order.Order/Get", nil)
+	call("/order.Order/Create", nil)
+	call("/order.Order/Create", status.Error(codes.Unavailable, "unavailable"))
+
+	entries := logs.TakeAll()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 log entries, got %d", len(entries))
+	}
+	for i, want := range []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel, zapcore.ErrorLevel} {
+		if entries[i].Level != want {
+			t.Errorf("Expected entry %d at %s, got %s", i, want, entries[i].Level)
+		}
+	}
+
+	ok := entries[1].ContextMap()
+	if ok["req"] != `{"service":"***"}` || ok["resp"] != `{"status":"SERVING"}` {
+		t.Errorf("Expected the redacted request and the reply, got %v", ok)
+	}
+	failed := entries[2].ContextMap()
+	if failed["code"] != "Unavailable" {
+		t.Errorf("Expected the code of the failed call, got %v", failed["code"])
+	}
+	if _, logged := failed["resp"]; logged {
+		t.Errorf("Expected no reply to be logged for a failed call, got %v", failed["resp"])
+	}
+}
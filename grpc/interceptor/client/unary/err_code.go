@@ -0,0 +1,17 @@
+package unary
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/grpc/errcode"
+
+	"google.golang.org/grpc"
+)
+
+// DecodeErrCode turns status errors carrying a business code into *errcode.StatusError, so callers can
+// get the *code.ErrCode with errors.As and still get the status with status.FromError.
+func DecodeErrCode() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return errcode.Decode(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
@@ -0,0 +1,47 @@
+package unary
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gw-gong/gwkit-go/util"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Retry retries calls that fail with one of retryableCodes (default codes.Unavailable) according to policy,
+// a nil policy uses the defaults of util.WithRetryPolicy. Share policy.Budget between the clients of one downstream.
+func Retry(policy *util.RetryPolicy, retryableCodes ...codes.Code) grpc.UnaryClientInterceptor {
+	if len(retryableCodes) == 0 {
+		retryableCodes = []codes.Code{codes.Unavailable}
+	}
+	p := util.RetryPolicy{}
+	if policy != nil {
+		p = *policy
+	}
+	isRetryable := p.IsRetryable
+	p.IsRetryable = func(err error) bool {
+		if isRetryable != nil && !isRetryable(err) {
+			return false
+		}
+		var s interface{ GRPCStatus() *status.Status }
+		if !errors.As(err, &s) {
+			return false
+		}
+		for _, c := range retryableCodes {
+			if s.GRPCStatus().Code() == c {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		_, _, err := util.WithRetryPolicy(ctx, &p, func(ctx context.Context) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+		return err
+	}
+}
@@ -0,0 +1,47 @@
+package unary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/util"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func failingInvoker(code codes.Code, calls *int) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		*calls++
+		return status.Error(code, "failed")
+	}
+}
+
+func TestRetryRetriesRetryableCodes(t *testing.T) {
+	interceptor := Retry(&util.RetryPolicy{MaxTries: 3, Interval: time.Millisecond})
+
+	calls := 0
+	err := interceptor(context.Background(), "/svc/Method", nil, nil, nil, failingInvoker(codes.Unavailable, &calls))
+	if calls != 3 || status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected 3 calls ending with Unavailable, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	_ = interceptor(context.Background(), "/svc/Method", nil, nil, nil, failingInvoker(codes.InvalidArgument, &calls))
+	if calls != 1 {
+		t.Errorf("Expected InvalidArgument not to be retried, got %d calls", calls)
+	}
+}
+
+func TestRetryRespectsBudget(t *testing.T) {
+	budget := util.NewRetryBudget(&util.RetryBudgetConfig{MinRetriesPerSecond: -1})
+	interceptor := Retry(&util.RetryPolicy{MaxTries: 3, Interval: time.Millisecond, Budget: budget})
+
+	calls := 0
+	_ = interceptor(context.Background(), "/svc/Method", nil, nil, nil, failingInvoker(codes.Unavailable, &calls))
+	if calls != 1 {
+		t.Errorf("Expected no retry with an exhausted budget, got %d calls", calls)
+	}
+}
@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/accesslog"
+
+	"google.golang.org/grpc"
+)
+
+// sizeCountingServerStream sums the sizes of the received and sent messages.
+type sizeCountingServerStream struct {
+	grpc.ServerStream
+	reqSize  int
+	respSize int
+}
+
+func (s *sizeCountingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.reqSize += accesslog.Size(m)
+	}
+	return err
+}
+
+func (s *sizeCountingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.respSize += accesslog.Size(m)
+	}
+	return err
+}
+
+// AccessLog logs every stream when the handler returns, sizes are summed over all messages and payloads are not logged.
+func AccessLog(cfg *accesslog.Config) grpc.StreamServerInterceptor {
+	logger := accesslog.NewAccessLogger(cfg)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if logger.Skip(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		start := time.Now()
+		counting := &sizeCountingServerStream{ServerStream: ss}
+		err := handler(srv, counting)
+		ctx := ss.Context()
+		logger.Log(ctx, "grpc server stream", &accesslog.Entry{
+			Method:   info.FullMethod,
+			Peer:     accesslog.PeerAddr(ctx),
+			Err:      err,
+			Latency:  time.Since(start),
+			ReqSize:  counting.reqSize,
+			RespSize: counting.respSize,
+		})
+		return err
+	}
+}
@@ -0,0 +1,18 @@
+package stream
+
+import (
+	"github.com/gw-gong/gwkit-go/grpc/errcode"
+
+	"google.golang.org/grpc"
+)
+
+// ErrCodeToStatus converts a *code.ErrCode returned by the handler into a gRPC status carrying the business code.
+func ErrCodeToStatus() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if ec, ok := errcode.FromError(err); ok {
+			return errcode.Error(ec)
+		}
+		return err
+	}
+}
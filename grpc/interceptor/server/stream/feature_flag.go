@@ -0,0 +1,35 @@
+package stream
+
+import (
+	"github.com/gw-gong/gwkit-go/featureflag"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var defaultFeatureFlagMetaAttributes = map[string]string{
+	"x-user-id":   featureflag.AttributeUserID,
+	"x-tenant-id": featureflag.AttributeTenant,
+}
+
+// ParseFeatureFlagAttrs is the stream variant of unary.ParseFeatureFlagAttrs, the attributes are set on the
+// context of the stream.
+func ParseFeatureFlagAttrs(metaAttributes map[string]string) grpc.StreamServerInterceptor {
+	if len(metaAttributes) == 0 {
+		metaAttributes = defaultFeatureFlagMetaAttributes
+	}
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := WrapServerStream(ss)
+		md, ok := metadata.FromIncomingContext(wrapped.Ctx)
+		if ok {
+			attrs := make(map[string]string, len(metaAttributes))
+			for key, attribute := range metaAttributes {
+				if values := md.Get(key); len(values) > 0 && values[0] != "" {
+					attrs[attribute] = values[0]
+				}
+			}
+			wrapped.Ctx = featureflag.WithAttributes(wrapped.Ctx, attrs)
+		}
+		return handler(srv, wrapped)
+	}
+}
@@ -0,0 +1,21 @@
+package stream
+
+import (
+	"github.com/gw-gong/gwkit-go/util"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func PanicRecoverInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (errInterceptor error) {
+		util.WithRecover(func() {
+			errInterceptor = handler(srv, ss)
+		}, func(err interface{}) {
+			util.DefaultPanicWithCtx(ss.Context(), err)
+			errInterceptor = status.Errorf(codes.Internal, "Internal Server Error (panic recovered)")
+		})
+		return
+	}
+}
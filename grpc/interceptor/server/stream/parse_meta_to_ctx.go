@@ -0,0 +1,38 @@
+package stream
+
+import (
+	"github.com/gw-gong/gwkit-go/util/trace"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func ParseMetaToCtx() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := WrapServerStream(ss)
+		ctx := wrapped.Ctx
+		md, ok := metadata.FromIncomingContext(ctx)
+		if ok {
+			var haveTraceInfo bool
+			requestIDs := md.Get(trace.LoggerFieldRequestID)
+			if len(requestIDs) > 0 && requestIDs[0] != "" {
+				ctx = trace.SetRequestIDToCtx(ctx, requestIDs[0])
+				ctx = trace.WithLogFieldRequestID(ctx, requestIDs[0])
+				haveTraceInfo = true
+			}
+			traceIDs := md.Get(trace.LoggerFieldTraceID)
+			if len(traceIDs) > 0 && traceIDs[0] != "" {
+				ctx = trace.SetTraceIDToCtx(ctx, traceIDs[0])
+				ctx = trace.WithLogFieldTraceID(ctx, traceIDs[0])
+				haveTraceInfo = true
+			}
+			if !haveTraceInfo {
+				newRequestID := trace.GenerateRequestID()
+				ctx = trace.SetRequestIDToCtx(ctx, newRequestID)
+				ctx = trace.WithLogFieldRequestID(ctx, newRequestID)
+			}
+		}
+		wrapped.Ctx = ctx
+		return handler(srv, wrapped)
+	}
+}
@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/featureflag"
+	clientstream "github.com/gw-gong/gwkit-go/grpc/interceptor/client/stream"
+	"github.com/gw-gong/gwkit-go/util/trace"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	serviceEchoRID = "echo-rid"
+	servicePanic   = "panic"
+)
+
+// traceHealthServer uses the server streaming Watch: it panics for servicePanic and otherwise
+// answers SERVING only if the stream context carries the request id expected by the test.
+type traceHealthServer struct {
+	healthpb.UnimplementedHealthServer
+	expectedRID string
+}
+
+func (s *traceHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if req.Service == servicePanic {
+		panic("boom")
+	}
+	servingStatus := healthpb.HealthCheckResponse_NOT_SERVING
+	if trace.GetRequestIDFromCtx(stream.Context()) == s.expectedRID {
+		servingStatus = healthpb.HealthCheckResponse_SERVING
+	}
+	return stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus})
+}
+
+func newBufconnClient(t *testing.T, expectedRID string) healthpb.HealthClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.ChainStreamInterceptor(PanicRecoverInterceptor(), ParseMetaToCtx()))
+	healthpb.RegisterHealthServer(server, &traceHealthServer{expectedRID: expectedRID})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(clientstream.InjectMetaFromCtx()),
+	)
+	if err != nil {
+		t.Fatalf("Expected client to be created, got %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestStreamInterceptorsPropagateRequestID(t *testing.T) {
+	client := newBufconnClient(t, "rid-123")
+
+	ctx := trace.SetRequestIDToCtx(context.Background(), "rid-123")
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: serviceEchoRID})
+	if err != nil {
+		t.Fatalf("Expected stream to open, got %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Expected a response, got %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected the handler to see the request id of the client")
+	}
+}
+
+func TestStreamInterceptorRecoversPanic(t *testing.T) {
+	client := newBufconnClient(t, "")
+
+	stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: servicePanic})
+	if err != nil {
+		t.Fatalf("Expected stream to open, got %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Internal {
+		t.Errorf("Expected codes.Internal from the recovered panic, got %v", err)
+	}
+
+	// the server is still alive
+	stream, _ = client.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: serviceEchoRID})
+	if _, err := stream.Recv(); err != nil {
+		t.Errorf("Expected the server to keep serving after a panic, got %v", err)
+	}
+}
+
+// ctxServerStream is a grpc.ServerStream that only carries a context.
+type ctxServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *ctxServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestParseFeatureFlagAttrs(t *testing.T) {
+	md := metadata.Pairs("x-user-id", "u1", "x-tenant-id", "t1")
+	ss := &ctxServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+
+	var userID, tenant string
+	err := ParseFeatureFlagAttrs(nil)(nil, ss, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+		userID = featureflag.GetAttribute(stream.Context(), featureflag.AttributeUserID)
+		tenant = featureflag.GetAttribute(stream.Context(), featureflag.AttributeTenant)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected handler to succeed, got %v", err)
+	}
+	if userID != "u1" || tenant != "t1" {
+		t.Errorf("Expected user u1 and tenant t1, got %q and %q", userID, tenant)
+	}
+}
@@ -0,0 +1,26 @@
+package stream
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// WrappedServerStream replaces the context of a grpc.ServerStream, so that interceptors can pass values
+// (rid/tid, feature flag attributes, ...) to stream handlers.
+type WrappedServerStream struct {
+	grpc.ServerStream
+	Ctx context.Context
+}
+
+func (w *WrappedServerStream) Context() context.Context {
+	return w.Ctx
+}
+
+// WrapServerStream returns ss itself if it is already wrapped, so chained interceptors don't stack wrappers.
+func WrapServerStream(ss grpc.ServerStream) *WrappedServerStream {
+	if wrapped, ok := ss.(*WrappedServerStream); ok {
+		return wrapped
+	}
+	return &WrappedServerStream{ServerStream: ss, Ctx: ss.Context()}
+}
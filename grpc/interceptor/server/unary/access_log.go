@@ -0,0 +1,33 @@
+package unary
+
+import (
+	"context"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/accesslog"
+
+	"google.golang.org/grpc"
+)
+
+// AccessLog logs every call after the handler returns, put it after ParseMetaToCtx so the log carries rid/tid.
+func AccessLog(cfg *accesslog.Config) grpc.UnaryServerInterceptor {
+	logger := accesslog.NewAccessLogger(cfg)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if logger.Skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		resp, err = handler(ctx, req)
+		logger.Log(ctx, "grpc server call", &accesslog.Entry{
+			Method:   info.FullMethod,
+			Peer:     accesslog.PeerAddr(ctx),
+			Err:      err,
+			Latency:  time.Since(start),
+			ReqSize:  accesslog.Size(req),
+			RespSize: accesslog.Size(resp),
+			Req:      req,
+			Resp:     resp,
+		})
+		return resp, err
+	}
+}
@@ -0,0 +1,60 @@
+package unary
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/accesslog"
+	"github.com/gw-gong/gwkit-go/log"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	interceptor := AccessLog(&accesslog.Config{
+		LogPayload:   true,
+		RedactFields: []string{"service"},
+		MethodLevels: map[string]log.LoggerLevel{"/order.Order/Get": log.LoggerLevelDebug},
+	})
+	call := func(method string, err error) {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		req := &healthpb.HealthCheckRequest{Service: "secret"}
+		_, _ = interceptor(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, err
+		})
+	}
+	call("/order.Order/Create", nil)
+	call("/order.Order/Get", nil)
+	call("/order.Order/Create", status.Error(codes.NotFound, "not found"))
+	call("/grpc.health.v1.Health/Check", nil)
+
+	entries := logs.TakeAll()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 log entries without the health check, got %d", len(entries))
+	}
+	for i, want := range []zapcore.Level{zapcore.InfoLevel, zapcore.DebugLevel, zapcore.WarnLevel} {
+		if entries[i].Level != want {
+			t.Errorf("Expected entry %d at %s, got %s", i, want, entries[i].Level)
+		}
+	}
+
+	fields := entries[2].ContextMap()
+	if fields["method"] != "/order.Order/Create" || fields["code"] != "NotFound" {
+		t.Errorf("Expected the method and code of the failed call, got %v", fields)
+	}
+	if fields["req"] != `{"service":"***"}` {
+		t.Errorf("Expected the redacted request, got %v", fields["req"])
+	}
+	if fields["resp"] != `{"status":"SERVING"}` {
+		t.Errorf("Expected the response, got %v", fields["resp"])
+	}
+}
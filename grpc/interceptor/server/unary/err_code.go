@@ -0,0 +1,20 @@
+package unary
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/grpc/errcode"
+
+	"google.golang.org/grpc"
+)
+
+// ErrCodeToStatus converts a *code.ErrCode returned by the handler into a gRPC status carrying the business code.
+func ErrCodeToStatus() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		resp, err = handler(ctx, req)
+		if ec, ok := errcode.FromError(err); ok {
+			return resp, errcode.Error(ec)
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,49 @@
+package unary
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/featureflag"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var defaultFeatureFlagMetaAttributes = map[string]string{
+	"x-user-id":   featureflag.AttributeUserID,
+	"x-tenant-id": featureflag.AttributeTenant,
+}
+
+// ParseFeatureFlagAttrs copies incoming metadata into the feature flag attributes of the handler context,
+// metaAttributes maps metadata key to attribute name, default x-user-id and x-tenant-id.
+func ParseFeatureFlagAttrs(metaAttributes map[string]string) grpc.UnaryServerInterceptor {
+	if len(metaAttributes) == 0 {
+		metaAttributes = defaultFeatureFlagMetaAttributes
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if ok {
+			attrs := make(map[string]string, len(metaAttributes))
+			for key, attribute := range metaAttributes {
+				if values := md.Get(key); len(values) > 0 && values[0] != "" {
+					attrs[attribute] = values[0]
+				}
+			}
+			ctx = featureflag.WithAttributes(ctx, attrs)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RequireFeatureFlag rejects calls with codes.Unimplemented when the global flag name is off for the call,
+// chain it after ParseFeatureFlagAttrs so that the targeting rules see the attributes.
+func RequireFeatureFlag(name string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if !featureflag.IsEnabled(ctx, name) {
+			return nil, status.Errorf(codes.Unimplemented, "feature %s is disabled for %s", name, info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+}
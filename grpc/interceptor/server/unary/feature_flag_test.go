@@ -0,0 +1,54 @@
+package unary
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/featureflag"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testInfo = &grpc.UnaryServerInfo{FullMethod: "/order.Order/Create"}
+
+// chain runs the interceptors in order around handler.
+func chain(ctx context.Context, handler grpc.UnaryHandler, interceptors ...grpc.UnaryServerInterceptor) (interface{}, error) {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, testInfo, next)
+		}
+	}
+	return handler(ctx, nil)
+}
+
+func TestRequireFeatureFlag(t *testing.T) {
+	prev := featureflag.L()
+	defer featureflag.ReplaceGlobals(prev)
+	featureflag.ReplaceGlobals(featureflag.NewFlagSet(&featureflag.Config{Flags: map[string]*featureflag.FlagConfig{
+		"beta": {Type: featureflag.FlagTypeBool, Enabled: true, Rules: []featureflag.Rule{
+			{Attribute: featureflag.AttributeTenant, Operator: featureflag.OperatorNotIn, Values: []string{"t1"}, Enabled: false},
+		}},
+	}}))
+
+	handled := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled++
+		return "ok", nil
+	}
+	interceptors := []grpc.UnaryServerInterceptor{ParseFeatureFlagAttrs(nil), RequireFeatureFlag("beta")}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "t1"))
+	if _, err := chain(ctx, handler, interceptors...); err != nil || handled != 1 {
+		t.Errorf("Expected the call of tenant t1 to be handled, got %v", err)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "t2"))
+	_, err := chain(ctx, handler, interceptors...)
+	if status.Code(err) != codes.Unimplemented || handled != 1 {
+		t.Errorf("Expected codes.Unimplemented for tenant t2, got %v", err)
+	}
+}
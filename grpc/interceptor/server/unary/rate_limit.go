@@ -0,0 +1,36 @@
+package unary
+
+import (
+	"context"
+
+	"github.com/gw-gong/gwkit-go/concurrency/ratelimit"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimit rejects calls with codes.ResourceExhausted once the limiter is exhausted.
+func RateLimit(limiter ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if !limiter.Allow() {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitByKey limits calls per key, keyFunc defaults to the full method name.
+func RateLimitByKey(limiter *ratelimit.KeyedLimiter, keyFunc func(ctx context.Context, info *grpc.UnaryServerInfo) string) grpc.UnaryServerInterceptor {
+	if keyFunc == nil {
+		keyFunc = func(ctx context.Context, info *grpc.UnaryServerInfo) string {
+			return info.FullMethod
+		}
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if !limiter.Allow(keyFunc(ctx, info)) {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,55 @@
+package unary
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gw-gong/gwkit-go/concurrency/ratelimit"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rateLimitConfig allows 2 calls per key during the test.
+var rateLimitConfig = &ratelimit.Config{Algorithm: ratelimit.AlgorithmSlidingWindow, Limit: 2, WindowMs: 60000}
+
+func okHandler(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(rateLimitConfig)
+	if err != nil {
+		t.Fatalf("Expected limiter to be created, got %v", err)
+	}
+	interceptor := RateLimit(limiter)
+
+	for i := 0; i < 2; i++ {
+		if _, err := interceptor(context.Background(), nil, testInfo, okHandler); err != nil {
+			t.Fatalf("Expected call %d to pass, got %v", i, err)
+		}
+	}
+	if _, err := interceptor(context.Background(), nil, testInfo, okHandler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected codes.ResourceExhausted over the limit, got %v", err)
+	}
+}
+
+func TestRateLimitByKey(t *testing.T) {
+	limiter, err := ratelimit.NewKeyedLimiter(rateLimitConfig, 10)
+	if err != nil {
+		t.Fatalf("Expected limiter to be created, got %v", err)
+	}
+	interceptor := RateLimitByKey(limiter, nil)
+	other := &grpc.UnaryServerInfo{FullMethod: "/order.Order/Get"}
+
+	for i := 0; i < 2; i++ {
+		_, _ = interceptor(context.Background(), nil, testInfo, okHandler)
+	}
+	if _, err := interceptor(context.Background(), nil, testInfo, okHandler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected the third call of %s to be limited, got %v", testInfo.FullMethod, err)
+	}
+	if _, err := interceptor(context.Background(), nil, other, okHandler); err != nil {
+		t.Errorf("Expected %s to have its own limit, got %v", other.FullMethod, err)
+	}
+}
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
+)
+
+// DiscoveryCache is a Discoverer that keeps the instances of every discovered service in memory. The first Discover
+// of a service asks the underlying Discoverer, later ones are served from memory, which is kept up to date by a Watch.
+// Once loaded, the instances survive discovery errors, the last known instances are returned until Watch recovers.
+type DiscoveryCache struct {
+	discoverer Discoverer
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mux     sync.Mutex
+	entries map[discoveryKey]*discoveryCacheEntry
+}
+
+type discoveryKey struct {
+	service string
+	tag     string
+}
+
+type discoveryCacheEntry struct {
+	ready chan struct{} // closed once the first discovery is done
+	err   error         // error of the first discovery, the entry is dropped then
+
+	mux       sync.RWMutex
+	instances []*ServiceInstance
+}
+
+func NewDiscoveryCache(discoverer Discoverer) *DiscoveryCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DiscoveryCache{
+		discoverer: discoverer,
+		ctx:        ctx,
+		cancel:     cancel,
+		entries:    make(map[discoveryKey]*discoveryCacheEntry),
+	}
+}
+
+func (c *DiscoveryCache) Discover(ctx context.Context, service, tag string) ([]*ServiceInstance, error) {
+	key := discoveryKey{service: service, tag: tag}
+	c.mux.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &discoveryCacheEntry{ready: make(chan struct{})}
+		c.entries[key] = entry
+	}
+	c.mux.Unlock()
+
+	if ok {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-entry.ready:
+		}
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		entry.mux.RLock()
+		defer entry.mux.RUnlock()
+		return entry.instances, nil
+	}
+
+	instances, err := c.discoverer.Discover(ctx, service, tag)
+	if err != nil {
+		entry.err = err
+		c.mux.Lock()
+		delete(c.entries, key)
+		c.mux.Unlock()
+		close(entry.ready)
+		return nil, err
+	}
+	entry.instances = instances
+	close(entry.ready)
+	c.watch(key, entry)
+	return instances, nil
+}
+
+// Watch is passed through to the underlying Discoverer.
+func (c *DiscoveryCache) Watch(ctx context.Context, service, tag string) (<-chan []*ServiceInstance, error) {
+	return c.discoverer.Watch(ctx, service, tag)
+}
+
+// Close stops the watches, Discover still works but no longer caches.
+func (c *DiscoveryCache) Close() {
+	c.cancel()
+}
+
+func (c *DiscoveryCache) watch(key discoveryKey, entry *discoveryCacheEntry) {
+	updates, err := c.discoverer.Watch(c.ctx, key.service, key.tag)
+	if err != nil {
+		log.Error("discovery cache failed to watch service", log.Str("service", key.service), log.Str("tag", key.tag), log.Err(err))
+		c.drop(key, entry)
+		return
+	}
+	go util.WithRecover(func() {
+		defer c.drop(key, entry)
+		for instances := range updates {
+			entry.mux.Lock()
+			entry.instances = instances
+			entry.mux.Unlock()
+		}
+	})
+}
+
+// drop removes entry once its watch ended, the next Discover of the service starts over.
+func (c *DiscoveryCache) drop(key discoveryKey, entry *discoveryCacheEntry) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.entries[key] == entry {
+		delete(c.entries, key)
+	}
+}
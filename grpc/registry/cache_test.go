@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingDiscoverer counts the discoveries passed to the underlying Discoverer.
+type countingDiscoverer struct {
+	Discoverer
+	discovers atomic.Int32
+}
+
+func (d *countingDiscoverer) Discover(ctx context.Context, service, tag string) ([]*ServiceInstance, error) {
+	d.discovers.Add(1)
+	return d.Discoverer.Discover(ctx, service, tag)
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	memory := NewMemoryRegistry()
+	instance := &ServiceInstance{ID: "a", Service: "order", Address: "10.0.0.2", Port: 80}
+	_ = memory.Register(context.Background(), instance)
+	discoverer := &countingDiscoverer{Discoverer: memory}
+	cache := NewDiscoveryCache(discoverer)
+	defer cache.Close()
+
+	for i := 0; i < 3; i++ {
+		instances, err := cache.Discover(context.Background(), "order", "")
+		if err != nil || len(instances) != 1 {
+			t.Fatalf("Expected 1 instance, got %d (%v)", len(instances), err)
+		}
+	}
+	if discovers := discoverer.discovers.Load(); discovers != 1 {
+		t.Errorf("Expected the cache to serve repeated discoveries, got %d discoveries", discovers)
+	}
+
+	_ = memory.Deregister(context.Background(), instance)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		instances, _ := cache.Discover(context.Background(), "order", "")
+		if len(instances) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the cache to follow the watch, still got %d instances", len(instances))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// staticDiscoverer returns fixed instances, or err.
+type staticDiscoverer struct {
+	instances []*ServiceInstance
+	err       error
+}
+
+func (d *staticDiscoverer) Discover(ctx context.Context, service, tag string) ([]*ServiceInstance, error) {
+	return d.instances, d.err
+}
+
+func (d *staticDiscoverer) Watch(ctx context.Context, service, tag string) (<-chan []*ServiceInstance, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestDiscoveryCacheDoesNotCacheErrors(t *testing.T) {
+	discoverer := &staticDiscoverer{err: errors.New("consul down")}
+	cache := NewDiscoveryCache(discoverer)
+	defer cache.Close()
+
+	if _, err := cache.Discover(context.Background(), "order", ""); err == nil {
+		t.Fatalf("Expected the discovery error")
+	}
+	discoverer.err = nil
+	discoverer.instances = []*ServiceInstance{{ID: "a"}}
+	if instances, err := cache.Discover(context.Background(), "order", ""); err != nil || len(instances) != 1 {
+		t.Errorf("Expected the discovery to be retried, got %d instances (%v)", len(instances), err)
+	}
+}
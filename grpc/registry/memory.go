@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gw-gong/gwkit-go/util"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// MemoryRegistry is an in-process Registry for tests, instances registered without health are passing.
+type MemoryRegistry struct {
+	mux       sync.Mutex
+	instances map[string]map[string]*ServiceInstance // service -> instance id -> instance
+	changed   chan struct{}                          // closed and replaced on every change, wakes up the watches
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		instances: make(map[string]map[string]*ServiceInstance),
+		changed:   make(chan struct{}),
+	}
+}
+
+// Register adds or replaces the instance with the same service and id.
+func (m *MemoryRegistry) Register(ctx context.Context, instance *ServiceInstance) error {
+	if instance == nil || instance.Service == "" || instance.ID == "" {
+		return fmt.Errorf("service name and instance id are required")
+	}
+	copied := *instance
+	if copied.Health == "" {
+		copied.Health = HealthPassing
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.instances[copied.Service] == nil {
+		m.instances[copied.Service] = make(map[string]*ServiceInstance)
+	}
+	m.instances[copied.Service][copied.ID] = &copied
+	m.notifyLocked()
+	return nil
+}
+
+func (m *MemoryRegistry) Deregister(ctx context.Context, instance *ServiceInstance) error {
+	if instance == nil {
+		return fmt.Errorf("instance is nil")
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if _, ok := m.instances[instance.Service][instance.ID]; ok {
+		delete(m.instances[instance.Service], instance.ID)
+		m.notifyLocked()
+	}
+	return nil
+}
+
+// SetHealth changes the health of a registered instance, e.g. to test failover.
+func (m *MemoryRegistry) SetHealth(service, id, health string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	instance, ok := m.instances[service][id]
+	if !ok {
+		return fmt.Errorf("instance %s of service %s not found", id, service)
+	}
+	copied := *instance
+	copied.Health = health
+	m.instances[service][id] = &copied
+	m.notifyLocked()
+	return nil
+}
+
+func (m *MemoryRegistry) Discover(ctx context.Context, service, tag string) ([]*ServiceInstance, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.discoverLocked(service, tag), nil
+}
+
+// ResolverBuilder resolves Target(service, tag) to the healthy instances registered in m.
+func (m *MemoryRegistry) ResolverBuilder() resolver.Builder {
+	return NewResolverBuilder(m)
+}
+
+func (m *MemoryRegistry) Watch(ctx context.Context, service, tag string) (<-chan []*ServiceInstance, error) {
+	updates := make(chan []*ServiceInstance, 1)
+	go util.WithRecover(func() {
+		defer close(updates)
+		for {
+			m.mux.Lock()
+			instances := m.discoverLocked(service, tag)
+			changed := m.changed
+			m.mux.Unlock()
+
+			SendLatest(updates, instances)
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	})
+	return updates, nil
+}
+
+// discoverLocked returns the instances sorted by id, the instances are never modified after they are stored.
+func (m *MemoryRegistry) discoverLocked(service, tag string) []*ServiceInstance {
+	instances := make([]*ServiceInstance, 0, len(m.instances[service]))
+	for _, instance := range m.instances[service] {
+		if instance.hasTag(tag) {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
+
+func (m *MemoryRegistry) notifyLocked() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, updates <-chan []*ServiceInstance) []*ServiceInstance {
+	t.Helper()
+	select {
+	case instances, ok := <-updates:
+		if !ok {
+			t.Fatalf("Expected an update, got a closed channel")
+		}
+		return instances
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected an update, got none")
+	}
+	return nil
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryRegistry()
+	if err := memory.Register(ctx, &ServiceInstance{Service: "order"}); err == nil {
+		t.Errorf("Expected an error for an instance without id")
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	updates, _ := memory.Watch(watchCtx, "order", "v1")
+	if instances := receive(t, updates); len(instances) != 0 {
+		t.Fatalf("Expected no instances yet, got %d", len(instances))
+	}
+
+	_ = memory.Register(ctx, &ServiceInstance{ID: "b", Service: "order", Tags: []string{"v1"}})
+	_ = memory.Register(ctx, &ServiceInstance{ID: "a", Service: "order", Tags: []string{"v1"}})
+	_ = memory.Register(ctx, &ServiceInstance{ID: "c", Service: "order", Tags: []string{"v2"}})
+	instances, _ := memory.Discover(ctx, "order", "v1")
+	if len(instances) != 2 || instances[0].ID != "a" || instances[1].ID != "b" {
+		t.Fatalf("Expected instances a and b with tag v1, got %v", instances)
+	}
+	if !instances[0].Healthy() {
+		t.Errorf("Expected instances without health to be passing, got %s", instances[0].Health)
+	}
+	if all, _ := memory.Discover(ctx, "order", ""); len(all) != 3 {
+		t.Errorf("Expected 3 instances without tag, got %d", len(all))
+	}
+
+	// the watch only keeps the latest update
+	if instances := receive(t, updates); len(instances) != 2 {
+		t.Errorf("Expected the latest 2 instances with tag v1, got %d", len(instances))
+	}
+
+	if err := memory.SetHealth("order", "a", HealthCritical); err != nil {
+		t.Fatalf("Expected health to be set, got %v", err)
+	}
+	if instances := receive(t, updates); len(HealthyInstances(instances)) != 1 {
+		t.Errorf("Expected 1 healthy instance after a became critical, got %d", len(HealthyInstances(instances)))
+	}
+
+	_ = memory.Deregister(ctx, &ServiceInstance{ID: "b", Service: "order"})
+	if instances := receive(t, updates); len(instances) != 1 || instances[0].ID != "a" {
+		t.Errorf("Expected only a after b was deregistered, got %v", instances)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Errorf("Expected no more updates after cancel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the updates channel to be closed after cancel")
+	}
+}
+
+func TestLoadStaticRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	content := `
+- service: order
+  address: 127.0.0.1
+  port: 8080
+  tags: [grpc]
+  meta:
+    zone: a
+- service: order
+  id: order-local
+  address: 127.0.0.1
+  port: 8081
+  health: critical
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Expected registry file to be written, got %v", err)
+	}
+	static, err := LoadStaticRegistry(path)
+	if err != nil {
+		t.Fatalf("Expected static registry to be loaded, got %v", err)
+	}
+
+	ctx := context.Background()
+	_ = static.Register(ctx, &ServiceInstance{ID: "x", Service: "order"})
+	instances, _ := static.Discover(ctx, "order", "")
+	if len(instances) != 2 {
+		t.Fatalf("Expected the 2 instances of the file, got %d", len(instances))
+	}
+	first, second := instances[0], instances[1]
+	if first.ID != "order-0" || first.Port != 8080 || first.Meta["zone"] != "a" || !first.Healthy() {
+		t.Errorf("Expected a passing instance order-0 on port 8080, got %+v", first)
+	}
+	if second.ID != "order-local" || second.Healthy() {
+		t.Errorf("Expected a critical instance order-local, got %+v", second)
+	}
+	if tagged, _ := static.Discover(ctx, "order", "grpc"); len(tagged) != 1 {
+		t.Errorf("Expected 1 instance with tag grpc, got %d", len(tagged))
+	}
+
+	if _, err := LoadStaticRegistry(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
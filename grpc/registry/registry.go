@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	HealthPassing  = "passing"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+)
+
+var ErrNoHealthyInstance = errors.New("no healthy instance")
+
+type ServiceInstance struct {
+	ID      string            `json:"id" yaml:"id" mapstructure:"id"`
+	Service string            `json:"service" yaml:"service" mapstructure:"service"`
+	Address string            `json:"address" yaml:"address" mapstructure:"address"`
+	Port    int               `json:"port" yaml:"port" mapstructure:"port"`
+	Tags    []string          `json:"tags" yaml:"tags" mapstructure:"tags"`
+	Meta    map[string]string `json:"meta" yaml:"meta" mapstructure:"meta"`
+	Weights Weights           `json:"weights" yaml:"weights" mapstructure:"weights"`
+	Health  string            `json:"health" yaml:"health" mapstructure:"health"` // HealthPassing, HealthWarning or HealthCritical
+}
+
+type Weights struct {
+	Passing int `json:"passing" yaml:"passing" mapstructure:"passing"`
+	Warning int `json:"warning" yaml:"warning" mapstructure:"warning"`
+}
+
+func (i *ServiceInstance) Healthy() bool {
+	return i.Health == HealthPassing
+}
+
+func (i *ServiceInstance) hasTag(tag string) bool {
+	if tag == "" {
+		return true
+	}
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func HealthyInstances(instances []*ServiceInstance) []*ServiceInstance {
+	healthy := make([]*ServiceInstance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.Healthy() {
+			healthy = append(healthy, instance)
+		}
+	}
+	return healthy
+}
+
+// Discoverer finds the instances of a service, an empty tag matches all instances.
+type Discoverer interface {
+	// Discover returns all instances of service with their health, use Healthy to filter them
+	Discover(ctx context.Context, service, tag string) ([]*ServiceInstance, error)
+	// Watch sends the instances of service, first the current ones and then every change, until ctx is done.
+	// A slow receiver only gets the latest instances, the channel is closed when ctx is done.
+	Watch(ctx context.Context, service, tag string) (<-chan []*ServiceInstance, error)
+}
+
+// Registry is where services register their instances and find the instances of others, implemented by
+// consul.NewConsulRegistry, NewMemoryRegistry for tests and NewStaticRegistry for local development.
+type Registry interface {
+	Register(ctx context.Context, instance *ServiceInstance) error
+	Deregister(ctx context.Context, instance *ServiceInstance) error
+	Discoverer
+}
+
+// SendLatest sends instances on updates as Watch requires, an update the receiver has not taken yet is replaced,
+// so the sender never blocks. updates must have a buffer of 1 and only one sender.
+func SendLatest(updates chan []*ServiceInstance, instances []*ServiceInstance) {
+	select {
+	case <-updates:
+	default:
+	}
+	updates <- instances
+}
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the scheme of the targets resolved by NewResolverBuilder, see Target.
+const Scheme = "registry"
+
+type instanceAttributeKey struct{}
+
+// Target returns the dial target of service, an empty tag matches all instances.
+func Target(service, tag string) string {
+	target := fmt.Sprintf("%s:///%s", Scheme, service)
+	if tag != "" {
+		target += "?tag=" + url.QueryEscape(tag)
+	}
+	return target
+}
+
+// NewResolverBuilder resolves Target(service, tag) to the healthy instances of service, following the changes
+// through Watch. It works with every Registry, so the dialing code is the same for consul, memory and static.
+func NewResolverBuilder(discoverer Discoverer) resolver.Builder {
+	return &resolverBuilder{discoverer: discoverer}
+}
+
+// NewGrpcConn dials service through discoverer, the connection follows the healthy instances of service.
+func NewGrpcConn(discoverer Discoverer, service, tag string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts, grpc.WithResolvers(NewResolverBuilder(discoverer)))
+	conn, err := grpc.NewClient(Target(service, tag), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc connection: %w", err)
+	}
+	return conn, nil
+}
+
+// InstanceFromAddress returns the instance behind an address resolved by NewResolverBuilder, for load balancers.
+func InstanceFromAddress(addr resolver.Address) (*ServiceInstance, bool) {
+	instance, ok := addr.BalancerAttributes.Value(instanceAttributeKey{}).(*ServiceInstance)
+	return instance, ok
+}
+
+type resolverBuilder struct {
+	discoverer Discoverer
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	service := strings.TrimPrefix(target.URL.Path, "/")
+	if service == "" {
+		return nil, fmt.Errorf("service name is required in target %s", target.URL.String())
+	}
+	r := &registryResolver{
+		discoverer: b.discoverer,
+		service:    service,
+		tag:        target.URL.Query().Get("tag"),
+		cc:         cc,
+	}
+	if err := r.watch(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type registryResolver struct {
+	discoverer Discoverer
+	service    string
+	tag        string
+	cc         resolver.ClientConn
+
+	mux    sync.Mutex
+	cancel context.CancelFunc
+	closed bool
+
+	generation atomic.Uint64 // of the current watch, updates of a replaced watch are dropped
+	updateMux  sync.Mutex    // serializes the updates, so a dropped update can't overwrite a newer one
+}
+
+// watch starts a new watch of the service, and stops the previous one once the new one is running.
+func (r *registryResolver) watch() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.closed {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := r.discoverer.Watch(ctx, r.service, r.tag)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to watch service %s: %w", r.service, err)
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.cancel = cancel
+	generation := r.generation.Add(1)
+
+	go util.WithRecover(func() {
+		for instances := range updates {
+			r.update(generation, instances)
+		}
+	})
+	return nil
+}
+
+func (r *registryResolver) update(generation uint64, instances []*ServiceInstance) {
+	r.updateMux.Lock()
+	defer r.updateMux.Unlock()
+	if generation != r.generation.Load() {
+		return
+	}
+
+	healthy := HealthyInstances(instances)
+	if len(healthy) == 0 {
+		r.cc.ReportError(fmt.Errorf("%w: service %s, tag %s", ErrNoHealthyInstance, r.service, r.tag))
+		return
+	}
+	addrs := make([]resolver.Address, 0, len(healthy))
+	for _, instance := range healthy {
+		addrs = append(addrs, resolver.Address{
+			Addr:               net.JoinHostPort(instance.Address, strconv.Itoa(instance.Port)),
+			BalancerAttributes: attributes.New(instanceAttributeKey{}, instance),
+		})
+	}
+	if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		log.Warn("registry resolver failed to update state", log.Str("service", r.service), log.Err(err))
+	}
+}
+
+// ResolveNow restarts the watch, which sends the current instances again, e.g. after the connections failed.
+// It runs in the background, so a slow registry doesn't block grpc.
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {
+	go util.WithRecover(func() {
+		if err := r.watch(); err != nil {
+			log.Warn("registry resolver failed to refresh", log.Str("service", r.service), log.Err(err))
+		}
+	})
+}
+
+func (r *registryResolver) Close() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.closed = true
+	r.generation.Add(1)
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
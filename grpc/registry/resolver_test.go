@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+)
+
+// startHealthServer serves the health service on a local port, only the health of name is SERVING.
+func startHealthServer(t *testing.T, name string) *ServiceInstance {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected listener to be created, got %v", err)
+	}
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(name, grpc_health_v1.HealthCheckResponse_SERVING)
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return &ServiceInstance{ID: name, Service: "order", Address: host, Port: portNum}
+}
+
+func TestTarget(t *testing.T) {
+	if target := Target("order", ""); target != "registry:///order" {
+		t.Errorf("Expected registry:///order, got %s", target)
+	}
+	if target := Target("order", "v1"); target != "registry:///order?tag=v1" {
+		t.Errorf("Expected registry:///order?tag=v1, got %s", target)
+	}
+}
+
+func TestResolverFollowsRegistry(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryRegistry()
+	a := startHealthServer(t, "a")
+	b := startHealthServer(t, "b")
+	_ = memory.Register(ctx, a)
+
+	conn, err := NewGrpcConn(memory, "order", "", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Expected connection to be created, got %v", err)
+	}
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	callCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if _, err := client.Check(callCtx, &grpc_health_v1.HealthCheckRequest{Service: "a"}); err != nil {
+		t.Fatalf("Expected the call to reach a, got %v", err)
+	}
+
+	_ = memory.Register(ctx, b)
+	_ = memory.Deregister(ctx, a)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := client.Check(callCtx, &grpc_health_v1.HealthCheckRequest{Service: "b"})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the calls to move to b, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// watchCountingDiscoverer counts the watches, to see that ResolveNow restarts the watch.
+type watchCountingDiscoverer struct {
+	Discoverer
+	watches atomic.Int32
+}
+
+func (d *watchCountingDiscoverer) Watch(ctx context.Context, service, tag string) (<-chan []*ServiceInstance, error) {
+	d.watches.Add(1)
+	return d.Discoverer.Watch(ctx, service, tag)
+}
+
+type fakeClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (c *fakeClientConn) UpdateState(state resolver.State) error {
+	c.states <- state
+	return nil
+}
+
+func (c *fakeClientConn) ReportError(error) {}
+
+func TestResolveNowRefreshesWatch(t *testing.T) {
+	static, err := NewStaticRegistry([]*ServiceInstance{{ID: "a", Service: "order", Address: "127.0.0.1", Port: 8080}})
+	if err != nil {
+		t.Fatalf("Expected static registry to be created, got %v", err)
+	}
+	discoverer := &watchCountingDiscoverer{Discoverer: static}
+	target, _ := url.Parse(Target("order", ""))
+	cc := &fakeClientConn{states: make(chan resolver.State, 10)}
+	r, err := NewResolverBuilder(discoverer).Build(resolver.Target{URL: *target}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Expected resolver to be built, got %v", err)
+	}
+	defer r.Close()
+
+	waitForState := func() {
+		select {
+		case state := <-cc.states:
+			if len(state.Addresses) != 1 || state.Addresses[0].Addr != "127.0.0.1:8080" {
+				t.Fatalf("Expected 127.0.0.1:8080, got %v", state.Addresses)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a state update")
+		}
+	}
+	waitForState()
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	waitForState()
+	if watches := discoverer.watches.Load(); watches != 2 {
+		t.Errorf("Expected ResolveNow to restart the watch, got %d watches", watches)
+	}
+}
+
+func TestStaticRegistryResolverBuilder(t *testing.T) {
+	a := startHealthServer(t, "a")
+	static, err := NewStaticRegistry([]*ServiceInstance{a})
+	if err != nil {
+		t.Fatalf("Expected static registry to be created, got %v", err)
+	}
+	conn, err := grpc.NewClient(Target("order", ""), grpc.WithResolvers(static.ResolverBuilder()),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Expected connection to be created, got %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "a"}); err != nil {
+		t.Errorf("Expected the call to reach a, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+type roundTripperOption func(rt *loadBalancedRoundTripper)
+
+// WithDiscoveryTag only sends requests to the instances with tag.
+func WithDiscoveryTag(tag string) roundTripperOption {
+	return func(rt *loadBalancedRoundTripper) {
+		rt.tag = tag
+	}
+}
+
+// loadBalancedRoundTripper resolves the host of the request url as a service name and sends the request
+// to its healthy instances in turn.
+type loadBalancedRoundTripper struct {
+	discoverer Discoverer
+	base       http.RoundTripper
+	tag        string
+
+	mux      sync.Mutex
+	counters map[string]uint64 // service -> requests sent
+}
+
+// NewLoadBalancedRoundTripper returns an http.RoundTripper for urls like http://service-name/path, the host is
+// replaced by a healthy instance of the service, round robin. Pass a DiscoveryCache as discoverer, otherwise every
+// request queries the registry. A nil base means http.DefaultTransport.
+//
+// Use it with client.NewBaseHTTPClient through client.WithTransportWrapper, or as http.Client.Transport.
+func NewLoadBalancedRoundTripper(discoverer Discoverer, base http.RoundTripper, opts ...roundTripperOption) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rt := &loadBalancedRoundTripper{
+		discoverer: discoverer,
+		base:       base,
+		counters:   make(map[string]uint64),
+	}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
+}
+
+func (rt *loadBalancedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := req.URL.Hostname()
+	instances, err := rt.discoverer.Discover(req.Context(), service, rt.tag)
+	if err != nil {
+		return nil, err
+	}
+	healthy := HealthyInstances(instances)
+	if len(healthy) == 0 {
+		return nil, fmt.Errorf("%w: service %s, tag %s", ErrNoHealthyInstance, service, rt.tag)
+	}
+	instance := healthy[rt.next(service)%uint64(len(healthy))]
+
+	// RoundTrip must not modify the request of the caller
+	outReq := req.Clone(req.Context())
+	outReq.URL.Host = net.JoinHostPort(instance.Address, strconv.Itoa(instance.Port))
+	outReq.Host = ""
+	return rt.base.RoundTrip(outReq)
+}
+
+func (rt *loadBalancedRoundTripper) next(service string) uint64 {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+	n := rt.counters[service]
+	rt.counters[service] = n + 1
+	return n
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLoadBalancedRoundTripper(t *testing.T) {
+	var instances []*ServiceInstance
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("backend-%d", i)
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+r.URL.Path)
+		}))
+		defer backend.Close()
+		host, port, _ := strings.Cut(strings.TrimPrefix(backend.URL, "http://"), ":")
+		portNum, _ := strconv.Atoi(port)
+		instances = append(instances, &ServiceInstance{ID: name, Address: host, Port: portNum, Health: HealthPassing})
+	}
+	instances = append(instances, &ServiceInstance{ID: "down", Address: "127.0.0.1", Port: 1, Health: HealthCritical})
+
+	client := &http.Client{Transport: NewLoadBalancedRoundTripper(&staticDiscoverer{instances: instances}, nil)}
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get("http://order/ping")
+		if err != nil {
+			t.Fatalf("Expected request to succeed, got %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		counts[string(body)]++
+	}
+	if counts["backend-0/ping"] != 2 || counts["backend-1/ping"] != 2 {
+		t.Errorf("Expected requests to be spread over the healthy backends, got %v", counts)
+	}
+
+	empty := &http.Client{Transport: NewLoadBalancedRoundTripper(&staticDiscoverer{}, nil)}
+	if _, err := empty.Get("http://order/ping"); !errors.Is(err, ErrNoHealthyInstance) {
+		t.Errorf("Expected ErrNoHealthyInstance, got %v", err)
+	}
+}
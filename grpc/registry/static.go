@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+// StaticRegistry serves a fixed list of instances, e.g. the local processes during development.
+// Register and Deregister do nothing, so services can keep registering themselves.
+type StaticRegistry struct {
+	memory *MemoryRegistry
+}
+
+// NewStaticRegistry returns a StaticRegistry of instances, instances without id get service-index as id,
+// instances without health are passing.
+func NewStaticRegistry(instances []*ServiceInstance) (*StaticRegistry, error) {
+	memory := NewMemoryRegistry()
+	for i, instance := range instances {
+		copied := *instance
+		if copied.ID == "" {
+			copied.ID = fmt.Sprintf("%s-%d", copied.Service, i)
+		}
+		if err := memory.Register(context.Background(), &copied); err != nil {
+			return nil, fmt.Errorf("invalid instance %d: %w", i, err)
+		}
+	}
+	return &StaticRegistry{memory: memory}, nil
+}
+
+// LoadStaticRegistry reads the instances from a yaml file with a list of instances, e.g.
+//
+//	# local_registry.yaml
+//	- service: order
+//	  address: 127.0.0.1
+//	  port: 8080
+//	  tags: [grpc]
+func LoadStaticRegistry(path string) (*StaticRegistry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static registry file: %w", err)
+	}
+	var instances []*ServiceInstance
+	if err := yaml.Unmarshal(content, &instances); err != nil {
+		return nil, fmt.Errorf("failed to parse static registry file: %w", err)
+	}
+	return NewStaticRegistry(instances)
+}
+
+func (s *StaticRegistry) Register(ctx context.Context, instance *ServiceInstance) error {
+	return nil
+}
+
+func (s *StaticRegistry) Deregister(ctx context.Context, instance *ServiceInstance) error {
+	return nil
+}
+
+func (s *StaticRegistry) Discover(ctx context.Context, service, tag string) ([]*ServiceInstance, error) {
+	return s.memory.Discover(ctx, service, tag)
+}
+
+func (s *StaticRegistry) Watch(ctx context.Context, service, tag string) (<-chan []*ServiceInstance, error) {
+	return s.memory.Watch(ctx, service, tag)
+}
+
+// ResolverBuilder resolves Target(service, tag) to the healthy instances of the static list.
+func (s *StaticRegistry) ResolverBuilder() resolver.Builder {
+	return NewResolverBuilder(s)
+}
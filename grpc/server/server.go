@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/consul"
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/accesslog"
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/server/stream"
+	"github.com/gw-gong/gwkit-go/grpc/interceptor/server/unary"
+	"github.com/gw-gong/gwkit-go/log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	defaultShutdownTimeoutMs = 10000
+)
+
+type Config struct {
+	Port              int  `json:"port" yaml:"port" mapstructure:"port"`
+	ShutdownTimeoutMs int  `json:"shutdown_timeout_ms" yaml:"shutdown_timeout_ms" mapstructure:"shutdown_timeout_ms"` // default 10000
+	EnableReflection  bool `json:"enable_reflection" yaml:"enable_reflection" mapstructure:"enable_reflection"`
+	UseTLS            bool `json:"use_tls" yaml:"use_tls" mapstructure:"use_tls"` // for the consul health check
+
+	DisableAccessLog bool             `json:"disable_access_log" yaml:"disable_access_log" mapstructure:"disable_access_log"`
+	AccessLog        accesslog.Config `json:"access_log" yaml:"access_log" mapstructure:"access_log"`
+}
+
+// Server is a grpc.Server with the default interceptor chain, the health service and the consul registration
+// tied to its lifecycle. Register the services on it, then call Run.
+type Server struct {
+	cfg          Config
+	grpcServer   *grpc.Server
+	healthServer *health.Server
+	listener     net.Listener
+	consulClient consul.ConsulClient
+	consulEntry  *consul.RegisterEntry
+
+	serverOpts         []grpc.ServerOption
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+}
+
+type option func(s *Server)
+
+// WithServerOptions adds grpc.ServerOption, e.g. credentials or keepalive.
+func WithServerOptions(opts ...grpc.ServerOption) option {
+	return func(s *Server) {
+		s.serverOpts = append(s.serverOpts, opts...)
+	}
+}
+
+// WithUnaryInterceptors appends interceptors after the default chain.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) option {
+	return func(s *Server) {
+		s.unaryInterceptors = append(s.unaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors appends interceptors after the default chain.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) option {
+	return func(s *Server) {
+		s.streamInterceptors = append(s.streamInterceptors, interceptors...)
+	}
+}
+
+// WithConsul registers the service after listen and deregisters it on shutdown.
+func WithConsul(client consul.ConsulClient, entry *consul.RegisterEntry) option {
+	return func(s *Server) {
+		s.consulClient = client
+		s.consulEntry = entry
+	}
+}
+
+// WithListener serves on listener instead of listening on cfg.Port, e.g. a bufconn listener in tests.
+func WithListener(listener net.Listener) option {
+	return func(s *Server) {
+		s.listener = listener
+	}
+}
+
+func NewServer(cfg *Config, opts ...option) *Server {
+	s := &Server{healthServer: health.NewServer()}
+	if cfg != nil {
+		s.cfg = *cfg
+	}
+	if s.cfg.ShutdownTimeoutMs <= 0 {
+		s.cfg.ShutdownTimeoutMs = defaultShutdownTimeoutMs
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// rid/tid first so every log carries them, access log outside of the panic recovery so panics are logged
+	unaryChain := []grpc.UnaryServerInterceptor{unary.ParseMetaToCtx()}
+	streamChain := []grpc.StreamServerInterceptor{stream.ParseMetaToCtx()}
+	if !s.cfg.DisableAccessLog {
+		unaryChain = append(unaryChain, unary.AccessLog(&s.cfg.AccessLog))
+		streamChain = append(streamChain, stream.AccessLog(&s.cfg.AccessLog))
+	}
+	unaryChain = append(unaryChain, unary.PanicRecoverInterceptor(), unary.ErrCodeToStatus())
+	streamChain = append(streamChain, stream.PanicRecoverInterceptor(), stream.ErrCodeToStatus())
+
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(append(unaryChain, s.unaryInterceptors...)...),
+		grpc.ChainStreamInterceptor(append(streamChain, s.streamInterceptors...)...),
+	}
+	s.grpcServer = grpc.NewServer(append(serverOpts, s.serverOpts...)...)
+	grpc_health_v1.RegisterHealthServer(s.grpcServer, s.healthServer)
+	if s.cfg.EnableReflection {
+		reflection.Register(s.grpcServer)
+	}
+	return s
+}
+
+// RegisterService implements grpc.ServiceRegistrar, so the generated RegisterXxxServer functions accept the Server.
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	s.grpcServer.RegisterService(desc, impl)
+}
+
+func (s *Server) GrpcServer() *grpc.Server {
+	return s.grpcServer
+}
+
+func (s *Server) HealthServer() *health.Server {
+	return s.healthServer
+}
+
+// Run serves until ctx is done, SIGTERM or SIGINT is received, or serving fails, then shuts down gracefully:
+// the health status becomes NOT_SERVING, the service is deregistered, and GracefulStop is given
+// ShutdownTimeoutMs before the remaining calls are cut off.
+func (s *Server) Run(ctx context.Context) error {
+	listener := s.listener
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Port))
+		if err != nil {
+			return fmt.Errorf("failed to listen on port %d: %w", s.cfg.Port, err)
+		}
+	}
+
+	for service := range s.grpcServer.GetServiceInfo() {
+		s.healthServer.SetServingStatus(service, grpc_health_v1.HealthCheckResponse_SERVING)
+	}
+	s.healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.grpcServer.Serve(listener)
+	}()
+	log.Info("grpc server started", log.Str("addr", listener.Addr().String()))
+
+	if err := s.register(listener); err != nil {
+		s.shutdown()
+		return err
+	}
+
+	signalCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	select {
+	case err := <-serveErr:
+		s.shutdown()
+		return err
+	case <-signalCtx.Done():
+		log.Info("grpc server shutting down", log.Str("cause", context.Cause(signalCtx).Error()))
+		s.shutdown()
+		if err := <-serveErr; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			return err
+		}
+		return nil
+	}
+}
+
+func (s *Server) register(listener net.Listener) error {
+	if s.consulClient == nil || s.consulEntry == nil {
+		return nil
+	}
+	if s.consulEntry.ServiceID == "" {
+		s.consulEntry.ServiceID = s.consulEntry.GenerateServiceID()
+	}
+	port := s.cfg.Port
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+	if err := s.consulClient.Register(s.consulEntry, port, s.cfg.UseTLS); err != nil {
+		return err
+	}
+	log.Info("consul service registration succeeded", log.Str("service_id", s.consulEntry.ServiceID))
+	return nil
+}
+
+func (s *Server) shutdown() {
+	s.healthServer.Shutdown()
+
+	if s.consulClient != nil && s.consulEntry != nil && s.consulEntry.ServiceID != "" {
+		if err := s.consulClient.Deregister(s.consulEntry.ServiceID); err != nil {
+			log.Error("consul service deregistration failed", log.Err(err))
+		} else {
+			log.Info("consul service deregistration succeeded", log.Str("service_id", s.consulEntry.ServiceID))
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	timer := time.NewTimer(time.Duration(s.cfg.ShutdownTimeoutMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		log.Warn("grpc server graceful stop timed out, closing remaining connections")
+		s.grpcServer.Stop()
+		<-stopped
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/grpc/consul"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeConsulClient struct {
+	consul.ConsulClient
+	mux          sync.Mutex
+	registered   []string
+	deregistered []string
+}
+
+func (f *fakeConsulClient) Register(entry *consul.RegisterEntry, port int, useTLS bool) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.registered = append(f.registered, entry.ServiceID)
+	return nil
+}
+
+func (f *fakeConsulClient) Deregister(serviceID string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.deregistered = append(f.deregistered, serviceID)
+	return nil
+}
+
+func TestServerLifecycle(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	consulClient := &fakeConsulClient{}
+	entry := &consul.RegisterEntry{ServiceName: "test_service"}
+	s := NewServer(&Config{ShutdownTimeoutMs: 100}, WithListener(listener), WithConsul(consulClient, entry))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(ctx)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Expected client to be created, got %v", err)
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Expected SERVING, got %v (%v)", resp, err)
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Expected a graceful shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Run to return after ctx is done")
+	}
+
+	if len(consulClient.registered) != 1 || entry.ServiceID == "" {
+		t.Errorf("Expected one registration with a generated service id, got %v", consulClient.registered)
+	}
+	if len(consulClient.deregistered) != 1 || consulClient.deregistered[0] != entry.ServiceID {
+		t.Errorf("Expected the service to be deregistered, got %v", consulClient.deregistered)
+	}
+	if resp, _ := s.HealthServer().Check(context.Background(), &healthpb.HealthCheckRequest{}); resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected NOT_SERVING after shutdown, got %v", resp.Status)
+	}
+}
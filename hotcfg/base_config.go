@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"sync"
 
-	"github.com/fsnotify/fsnotify"
+	"github.com/gw-gong/gwkit-go/log"
+
 	"github.com/spf13/viper"
 	_ "github.com/spf13/viper/remote"
 )
@@ -108,14 +109,13 @@ func (c *BaseConfig) AsLocalConfig() LocalConfig {
 	return nil
 }
 
+// WatchLocalConfig reloads the config file after changes settle for LocalConfigOption.DebounceMs,
+// loadConfig is only called when the parsed content has changed.
 func (c *BaseConfig) WatchLocalConfig(loadConfig func()) {
 	if c.ConfigType == ConfigTypeLocal {
-		c.Viper.WatchConfig()
-		c.Viper.OnConfigChange(func(e fsnotify.Event) {
-			c.mux.Lock()
-			defer c.mux.Unlock()
-			loadConfig()
-		})
+		if err := newLocalConfigWatcher(c, loadConfig).start(); err != nil {
+			log.Error("failed to watch local config", log.Str("configFile", c.Viper.ConfigFileUsed()), log.Err(err))
+		}
 	}
 }
 
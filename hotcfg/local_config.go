@@ -8,4 +8,6 @@ type LocalConfigOption struct {
 	FilePath string `json:"filePath" yaml:"filePath" mapstructure:"filePath"`
 	FileName string `json:"fileName" yaml:"fileName" mapstructure:"fileName"`
 	FileType string `json:"fileType" yaml:"fileType" mapstructure:"fileType"`
+	// quiet period before reloading after file events, default DefaultLocalConfigDebounceMs
+	DebounceMs int `json:"debounceMs" yaml:"debounceMs" mapstructure:"debounceMs"`
 }
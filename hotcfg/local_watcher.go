@@ -0,0 +1,129 @@
+package hotcfg
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	DefaultLocalConfigDebounceMs = 200
+)
+
+// localConfigWatcher watches the directory of the local config file, so that renames and atomic saves
+// (editors, k8s ConfigMap symlink replacement) are picked up. Bursts of events are coalesced into one reload
+// after a quiet period, and loadConfig is only called when the parsed content actually changed.
+// WatchLocalConfig never stops the watcher, like the consul polling it lives as long as the process.
+type localConfigWatcher struct {
+	config     *BaseConfig
+	loadConfig func()
+	debounce   time.Duration
+	done       chan struct{}
+
+	configFile     string
+	realConfigFile string
+	lastConfigHash string
+	reloadTimer    *time.Timer
+}
+
+func newLocalConfigWatcher(c *BaseConfig, loadConfig func()) *localConfigWatcher {
+	debounceMs := c.LocalConfigOption.DebounceMs
+	if debounceMs <= 0 {
+		debounceMs = DefaultLocalConfigDebounceMs
+	}
+	configFile := filepath.Clean(c.Viper.ConfigFileUsed())
+	realConfigFile, _ := filepath.EvalSymlinks(configFile)
+	return &localConfigWatcher{
+		config:         c,
+		loadConfig:     loadConfig,
+		debounce:       time.Duration(debounceMs) * time.Millisecond,
+		done:           make(chan struct{}),
+		configFile:     configFile,
+		realConfigFile: realConfigFile,
+		lastConfigHash: CalculateConfigHash(c.Viper),
+	}
+}
+
+func (w *localConfigWatcher) start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	configDir, _ := filepath.Split(w.configFile)
+	if err := watcher.Add(configDir); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	go util.WithRecover(func() {
+		defer watcher.Close()
+		w.watch(watcher)
+	})
+	return nil
+}
+
+// stop ends the watch goroutine and drops a pending reload.
+func (w *localConfigWatcher) stop() {
+	close(w.done)
+}
+
+func (w *localConfigWatcher) watch(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case <-w.done:
+			if w.reloadTimer != nil {
+				w.reloadTimer.Stop()
+			}
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			currentConfigFile, _ := filepath.EvalSymlinks(w.configFile)
+			// we only care about the config file with the following cases:
+			// 1 - if the config file was modified or created
+			// 2 - if the real path to the config file changed (eg: k8s ConfigMap replacement)
+			if (filepath.Clean(event.Name) == w.configFile && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create))) ||
+				(currentConfigFile != "" && currentConfigFile != w.realConfigFile) {
+				w.realConfigFile = currentConfigFile
+				w.scheduleReload()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error("local config watcher error", log.Str("configFile", w.configFile), log.Err(err))
+		}
+	}
+}
+
+// scheduleReload (re)starts the quiet period, only called from the watch goroutine.
+func (w *localConfigWatcher) scheduleReload() {
+	if w.reloadTimer == nil {
+		w.reloadTimer = time.AfterFunc(w.debounce, func() {
+			util.WithRecover(w.reload)
+		})
+		return
+	}
+	w.reloadTimer.Reset(w.debounce)
+}
+
+func (w *localConfigWatcher) reload() {
+	w.config.mux.Lock()
+	defer w.config.mux.Unlock()
+
+	if err := w.config.Viper.ReadInConfig(); err != nil {
+		log.Error("failed to read local configuration", log.Str("configFile", w.configFile), log.Err(err))
+		return
+	}
+
+	currentConfigHash := CalculateConfigHash(w.config.Viper)
+	if currentConfigHash == "" || currentConfigHash == w.lastConfigHash {
+		return
+	}
+	w.lastConfigHash = currentConfigHash
+	w.loadConfig()
+}
@@ -0,0 +1,68 @@
+package hotcfg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLocalWatcher(t *testing.T, content string, reloads *atomic.Int32) (*localConfigWatcher, string) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("Expected config file to be written, got %v", err)
+	}
+	c, err := newBaseConfig(withLocalConfig(&LocalConfigOption{FilePath: dir, FileName: "app", FileType: "yaml", DebounceMs: 50}))
+	if err != nil {
+		t.Fatalf("Expected config to be loaded, got %v", err)
+	}
+	w := newLocalConfigWatcher(c, func() {
+		reloads.Add(1)
+	})
+	if err := w.start(); err != nil {
+		t.Fatalf("Expected watcher to start, got %v", err)
+	}
+	t.Cleanup(w.stop)
+	return w, file
+}
+
+func TestLocalWatcherDebouncesBurst(t *testing.T) {
+	var reloads atomic.Int32
+	_, file := newTestLocalWatcher(t, "value: 0\n", &reloads)
+
+	for i := 1; i <= 5; i++ {
+		if err := os.WriteFile(file, []byte(fmt.Sprintf("value: %d\n", i)), 0o644); err != nil {
+			t.Fatalf("Expected config file to be written, got %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := reloads.Load(); n != 1 {
+		t.Errorf("Expected 1 reload for the burst, got %d", n)
+	}
+}
+
+func TestLocalWatcherSkipsUnchangedContent(t *testing.T) {
+	var reloads atomic.Int32
+	_, file := newTestLocalWatcher(t, "value: 1\n", &reloads)
+
+	if err := os.WriteFile(file, []byte("value: 1\n"), 0o644); err != nil {
+		t.Fatalf("Expected config file to be written, got %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := reloads.Load(); n != 0 {
+		t.Errorf("Expected no reload for unchanged content, got %d", n)
+	}
+
+	if err := os.WriteFile(file, []byte("value: 2\n"), 0o644); err != nil {
+		t.Fatalf("Expected config file to be written, got %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := reloads.Load(); n != 1 {
+		t.Errorf("Expected 1 reload after the content changed, got %d", n)
+	}
+}
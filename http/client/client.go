@@ -8,9 +8,11 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gw-gong/gwkit-go/log"
+	"github.com/gw-gong/gwkit-go/util"
 	"github.com/gw-gong/gwkit-go/util/str"
 	"github.com/gw-gong/gwkit-go/util/trace"
 
@@ -44,9 +46,20 @@ type BaseHTTPClient interface {
 
 type baseHTTPClient struct {
 	http.Client
+	transport *http.Transport
 }
 
-func NewBaseHTTPClient(cfg *BaseHTTPClientCfg) BaseHTTPClient {
+type option func(c *baseHTTPClient)
+
+// WithTransportWrapper wraps the transport of the client, e.g. with registry.NewLoadBalancedRoundTripper
+// to send requests for http://service-name/ to the instances of the service.
+func WithTransportWrapper(wrap func(base http.RoundTripper) http.RoundTripper) option {
+	return func(c *baseHTTPClient) {
+		c.Transport = wrap(c.Transport)
+	}
+}
+
+func NewBaseHTTPClient(cfg *BaseHTTPClientCfg, opts ...option) BaseHTTPClient {
 	if cfg == nil {
 		cfg = defaultBaseHTTPClientCfg
 	}
@@ -59,29 +72,31 @@ func NewBaseHTTPClient(cfg *BaseHTTPClientCfg) BaseHTTPClient {
 	if cfg.MaxConnsPerHost <= 0 {
 		cfg.MaxConnsPerHost = defaultBaseHTTPClientCfg.MaxConnsPerHost
 	}
-	return &baseHTTPClient{
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		// TLSClientConfig:     tlsConfig, // TODO: Support tls config
+		DialContext: (&net.Dialer{
+			Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
+			KeepAlive: time.Duration(defaultKeepAliveMs) * time.Millisecond,
+		}).DialContext,
+		TLSHandshakeTimeout: time.Duration(defaultTLSHandshakeTimeoutMs) * time.Millisecond,
+	}
+	c := &baseHTTPClient{
 		Client: http.Client{
-			Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond,
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
-				MaxConnsPerHost:     cfg.MaxConnsPerHost,
-				// TLSClientConfig:     tlsConfig, // TODO: Support tls config
-				DialContext: (&net.Dialer{
-					Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
-					KeepAlive: time.Duration(defaultKeepAliveMs) * time.Millisecond,
-				}).DialContext,
-				TLSHandshakeTimeout: time.Duration(defaultTLSHandshakeTimeoutMs) * time.Millisecond,
-			},
+			Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
+			Transport: transport,
 		},
+		transport: transport,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *baseHTTPClient) Close() {
-	if c.Transport != nil {
-		if transport, ok := c.Transport.(*http.Transport); ok {
-			transport.CloseIdleConnections()
-		}
-	}
+	c.transport.CloseIdleConnections()
 }
 
 func (c *baseHTTPClient) DoRequest(ctx context.Context, method, url string, reqJsonBody interface{}, headerItems ...HeaderItem) (
@@ -158,6 +173,45 @@ func (c *baseHTTPClient) DoRequest(ctx context.Context, method, url string, reqJ
 	return resp.StatusCode, false, respBody, nil
 }
 
+// idempotentMethods are retried by DoRequestWithRetry without an IsRetryable of the caller.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// DoRequestWithRetry retries c.DoRequest on network errors, timeouts and 5xx responses according to policy,
+// a nil policy uses the defaults of util.WithRetryPolicy. Without policy.IsRetryable only the idempotent methods
+// GET, HEAD, PUT, DELETE and OPTIONS are retried, a POST or PATCH may already have been applied by the server.
+// Set policy.IsRetryable to opt in, it then decides for every method. Share policy.Budget between the clients
+// of one downstream.
+func DoRequestWithRetry(ctx context.Context, c BaseHTTPClient, policy *util.RetryPolicy, method, url string, reqJsonBody interface{}, headerItems ...HeaderItem) (
+	httpStatus int, isTimeout bool, respBody []byte, err error) {
+	p := util.RetryPolicy{}
+	if policy != nil {
+		p = *policy
+	}
+	isRetryable := p.IsRetryable
+	p.IsRetryable = func(err error) bool {
+		if httpStatus != HTTPStatusUnknown && httpStatus < http.StatusInternalServerError {
+			return false
+		}
+		if isRetryable == nil {
+			return idempotentMethods[strings.ToUpper(method)] && !errors.Is(err, context.Canceled)
+		}
+		return isRetryable(err)
+	}
+
+	_, _, err = util.WithRetryPolicy(ctx, &p, func(ctx context.Context) error {
+		var tryErr error
+		httpStatus, isTimeout, respBody, tryErr = c.DoRequest(ctx, method, url, reqJsonBody, headerItems...)
+		return tryErr
+	})
+	return httpStatus, isTimeout, respBody, err
+}
+
 func (c *baseHTTPClient) setHeaderTraceInfo(ctx context.Context, header http.Header) {
 	if requestID := trace.GetRequestIDFromCtx(ctx); requestID != "" {
 		header.Set(trace.HttpHeaderRequestID, requestID)
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gw-gong/gwkit-go/util"
+)
+
+func newStatusServer(t *testing.T, status int, hits *atomic.Int32) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestDoRequestWithRetry(t *testing.T) {
+	c := NewBaseHTTPClient(nil)
+	defer c.Close()
+	policy := &util.RetryPolicy{MaxTries: 3, Interval: time.Millisecond}
+
+	var hits atomic.Int32
+	url := newStatusServer(t, http.StatusServiceUnavailable, &hits)
+	status, _, _, err := DoRequestWithRetry(context.Background(), c, policy, http.MethodGet, url, nil)
+	if hits.Load() != 3 || status != http.StatusServiceUnavailable || err == nil {
+		t.Errorf("Expected 3 requests ending with 503, got %d requests, status %d and %v", hits.Load(), status, err)
+	}
+
+	hits.Store(0)
+	url = newStatusServer(t, http.StatusNotFound, &hits)
+	_, _, _, _ = DoRequestWithRetry(context.Background(), c, policy, http.MethodGet, url, nil)
+	if hits.Load() != 1 {
+		t.Errorf("Expected a 4xx response not to be retried, got %d requests", hits.Load())
+	}
+}
+
+func TestDoRequestWithRetryRespectsBudget(t *testing.T) {
+	c := NewBaseHTTPClient(nil)
+	defer c.Close()
+	budget := util.NewRetryBudget(&util.RetryBudgetConfig{MinRetriesPerSecond: -1})
+
+	var hits atomic.Int32
+	url := newStatusServer(t, http.StatusServiceUnavailable, &hits)
+	_, _, _, _ = DoRequestWithRetry(context.Background(), c, &util.RetryPolicy{MaxTries: 3, Interval: time.Millisecond, Budget: budget},
+		http.MethodGet, url, nil)
+	if hits.Load() != 1 {
+		t.Errorf("Expected no retry with an exhausted budget, got %d requests", hits.Load())
+	}
+}
+
+func TestDoRequestWithRetryOnlyRetriesIdempotentMethods(t *testing.T) {
+	c := NewBaseHTTPClient(nil)
+	defer c.Close()
+
+	var hits atomic.Int32
+	url := newStatusServer(t, http.StatusServiceUnavailable, &hits)
+	for _, method := range []string{http.MethodPost, http.MethodPatch} {
+		hits.Store(0)
+		_, _, _, _ = DoRequestWithRetry(context.Background(), c, &util.RetryPolicy{MaxTries: 3, Interval: time.Millisecond},
+			method, url, nil)
+		if hits.Load() != 1 {
+			t.Errorf("Expected %s not to be retried by default, got %d requests", method, hits.Load())
+		}
+	}
+
+	hits.Store(0)
+	optIn := &util.RetryPolicy{MaxTries: 3, Interval: time.Millisecond, IsRetryable: func(err error) bool { return true }}
+	_, _, _, _ = DoRequestWithRetry(context.Background(), c, optIn, http.MethodPost, url, nil)
+	if hits.Load() != 3 {
+		t.Errorf("Expected POST to be retried with IsRetryable, got %d requests", hits.Load())
+	}
+}
@@ -28,6 +28,9 @@ var (
 	// Client errors
 	// ErrParam            = NewErrorCode(100000000, "param error", http.StatusOK)
 	// ErrPermissionDenied = NewErrorCode(100000001, "permission denied", http.StatusOK)
+	// 429 instead of 200, so that clients and gateways back off and retry later
+	ErrTooManyRequests = NewErrCode(100000002, "too many requests", http.StatusTooManyRequests)
+	ErrFeatureDisabled = NewErrCode(100000003, "feature is disabled", http.StatusOK)
 
 	// Server Error
 	ErrInternal = NewErrCode(200000000, "internal server error", http.StatusOK)
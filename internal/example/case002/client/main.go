@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 
+	"github.com/gw-gong/gwkit-go/grpc/balancer"
 	"github.com/gw-gong/gwkit-go/grpc/consul"
 	"github.com/gw-gong/gwkit-go/grpc/interceptor/client/unary"
 	"github.com/gw-gong/gwkit-go/log"
@@ -28,6 +29,7 @@ func main() {
 	testClient, err := NewTestClient(consulClient, &consul.HealthyGrpcConnEntry{
 		ServiceName: "test_service",
 		Tag:         "test",
+		Policy:      balancer.PolicyRoundRobin,
 		Opts:        []grpc.DialOption{grpc.WithChainUnaryInterceptor(unary.InjectMetaFromCtx())},
 	})
 	util.ExitOnErr(ctx, err)
@@ -2,18 +2,12 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"net"
 
 	"github.com/gw-gong/gwkit-go/grpc/consul"
-	"github.com/gw-gong/gwkit-go/grpc/interceptor/server/unary"
+	"github.com/gw-gong/gwkit-go/grpc/server"
 	"github.com/gw-gong/gwkit-go/internal/example/case002/protobuf"
 	"github.com/gw-gong/gwkit-go/log"
 	"github.com/gw-gong/gwkit-go/util"
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/health"
-	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const (
@@ -35,37 +29,11 @@ func main() {
 		ServiceName: ServiceName,
 		Tags:        []string{ServiceTag},
 	}
-	registerEntry.GenerateServiceID()
-	err = consulClient.Register(registerEntry, ServerPort, false)
-	util.ExitOnErr(context.Background(), err)
-	defer func() {
-		err = consulClient.Deregister(registerEntry.ServiceID)
-		if err != nil {
-			log.Error("consul service deregistration failed", log.Err(err))
-		}
-		log.Info("consul service deregistration succeeded")
-	}()
-
-	log.Info("consul service registration succeeded")
-
-	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			unary.PanicRecoverInterceptor(),
-			unary.ParseMetaToCtx(),
-		),
-	)
 
-	healthServer := health.NewServer()
-	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
-
-	testService := NewTestService()
-	protobuf.RegisterTestServiceServer(grpcServer, testService)
-
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", ServerPort))
-	util.ExitOnErr(context.Background(), err)
-	defer listener.Close()
+	// health status, consul registration and graceful shutdown on SIGTERM are handled by the server
+	grpcServer := server.NewServer(&server.Config{Port: ServerPort}, server.WithConsul(consulClient, registerEntry))
+	protobuf.RegisterTestServiceServer(grpcServer, NewTestService())
 
-	log.Info("服务启动成功", log.Str("port", fmt.Sprintf("%d", ServerPort)))
-	err = grpcServer.Serve(listener)
+	err = grpcServer.Run(context.Background())
 	util.ExitOnErr(context.Background(), err)
 }
@@ -2,6 +2,7 @@ package util
 
 import (
 	"context"
+	"fmt"
 	"runtime/debug"
 
 	"github.com/gw-gong/gwkit-go/log"
@@ -32,3 +33,19 @@ func DefaultPanicHandler(err interface{}) {
 func DefaultPanicWithCtx(ctx context.Context, err interface{}) {
 	log.Errorc(ctx, "panic", log.Any("err", err), log.Str("stack", string(debug.Stack())))
 }
+
+// PanicError carries a recovered panic value and the stack of the panicking goroutine,
+// for callers that want to surface panics as errors instead of only logging them.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// NewPanicError must be called inside the panic handler, so that the stack still contains the panicking frames.
+func NewPanicError(value interface{}) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
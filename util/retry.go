@@ -15,49 +15,45 @@ const (
 // WithRetry is a function that retries a function until it returns false or the context is canceled.
 // maxTries is the maximum number of tries, interval is the interval between tries.
 // allTries is the number of tries, allErrs is the "returned error" of all tries, lastErr is the error of the last try.
-func WithRetry(ctx context.Context, maxTries int, interval time.Duration, operationFunc func() (shouldRetry bool, err error)) (allTries int, allErrs []error, lastErr error) {
+// It runs the same loop as WithRetryPolicy with the default policy, but the caller decides about retrying, so
+// e.g. polling can retry without an error.
+func WithRetry(ctx context.Context, maxTries int, interval time.Duration, operationFunc func() (shouldRetry bool, err error), opts ...retryOption) (allTries int, allErrs []error, lastErr error) {
 	if ctx == nil {
 		return 0, []error{fmt.Errorf("context cannot be nil")}, fmt.Errorf("context cannot be nil")
 	}
 	if operationFunc == nil {
 		return 0, []error{fmt.Errorf("operationFunc cannot be nil")}, fmt.Errorf("operationFunc cannot be nil")
 	}
-	if maxTries <= 0 {
-		maxTries = DefaultMaxTries
-	}
-	if interval <= 0 {
-		interval = DefaultRetryInterval
+	policy := &RetryPolicy{MaxTries: maxTries, Interval: interval}
+	for _, opt := range opts {
+		opt(policy)
 	}
+	return retryLoop(ctx, policy.withDefaults(), func(ctx context.Context) (bool, error) {
+		return operationFunc()
+	})
+}
 
-	allErrs = make([]error, 0, maxTries)
-	for i := 1; i <= maxTries; i++ {
-		shouldRetry, err := operationFunc()
-		lastErr = err
-		if err != nil {
-			allErrs = append(allErrs, fmt.Errorf("try %d/%d failed: %w", i, maxTries, lastErr))
-		}
-		if !shouldRetry {
-			return i, allErrs, lastErr
-		}
+type retryOption func(p *RetryPolicy)
 
-		// The last loop does not need to wait, just return
-		if i == maxTries {
-			break
-		}
+// WithRetryBudget makes WithRetry record its successes in budget and stop retrying once budget is exhausted,
+// see RetryPolicy.Budget.
+func WithRetryBudget(budget *RetryBudget) retryOption {
+	return func(p *RetryPolicy) {
+		p.Budget = budget
+	}
+}
 
-		select {
-		case <-ctx.Done():
-			lastErr = fmt.Errorf("canceled after %d/%d try: %w", i, maxTries, ctx.Err())
-			allErrs = append(allErrs, lastErr)
-			return i, allErrs, lastErr
-		default:
-			// Exponential backoff: 1x, 2x, 4x, 8x, ...
-			backoff := time.Duration(1<<uint(i-1)) * interval
-			if backoff > MaxBackoff {
-				backoff = MaxBackoff
-			}
-			time.Sleep(backoff)
-		}
+// sleepCtx sleeps for d, or returns ctx.Err() as soon as ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	return maxTries, allErrs, lastErr
 }
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+type RetryBudgetConfig struct {
+	// RetryPercent is the share of the successful calls in the window that may be retried, default 20
+	RetryPercent float64 `json:"retry_percent" yaml:"retry_percent" mapstructure:"retry_percent"`
+	// MinRetriesPerSecond allows some retries when there are few successful calls, default 10, negative disables it
+	MinRetriesPerSecond int `json:"min_retries_per_second" yaml:"min_retries_per_second" mapstructure:"min_retries_per_second"`
+	WindowMs            int `json:"window_ms" yaml:"window_ms" mapstructure:"window_ms"` // default 10000
+}
+
+const (
+	defaultRetryBudgetPercent      = 20
+	defaultRetryBudgetMinPerSecond = 10
+	defaultRetryBudgetWindowMs     = 10000
+	retryBudgetWindowBuckets       = 10
+)
+
+// RetryBudget is shared by all callers of one downstream, so that retries stay a fraction of the traffic
+// during an outage instead of multiplying it.
+type RetryBudget struct {
+	cfg            RetryBudgetConfig
+	bucketDuration time.Duration
+	now            func() time.Time
+
+	mux     sync.Mutex
+	buckets [retryBudgetWindowBuckets]retryBudgetBucket
+}
+
+type retryBudgetBucket struct {
+	index     int64 // time index of the bucket, used to detect stale buckets
+	successes int
+	retries   int
+}
+
+func NewRetryBudget(cfg *RetryBudgetConfig) *RetryBudget {
+	c := RetryBudgetConfig{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.RetryPercent <= 0 {
+		c.RetryPercent = defaultRetryBudgetPercent
+	}
+	if c.MinRetriesPerSecond < 0 {
+		c.MinRetriesPerSecond = 0
+	} else if c.MinRetriesPerSecond == 0 {
+		c.MinRetriesPerSecond = defaultRetryBudgetMinPerSecond
+	}
+	if c.WindowMs <= 0 {
+		c.WindowMs = defaultRetryBudgetWindowMs
+	}
+	return &RetryBudget{
+		cfg:            c,
+		bucketDuration: time.Duration(c.WindowMs) * time.Millisecond / retryBudgetWindowBuckets,
+		now:            time.Now,
+	}
+}
+
+// RecordSuccess deposits a successful call, nil budgets are ignored.
+func (b *RetryBudget) RecordSuccess() {
+	if b == nil {
+		return
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.bucketLocked(b.now()).successes++
+}
+
+// TryRetry withdraws a retry and reports whether it is allowed, a nil budget always allows.
+func (b *RetryBudget) TryRetry() bool {
+	if b == nil {
+		return true
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := b.now()
+	successes, retries := b.countsLocked(now)
+	allowed := float64(successes)*b.cfg.RetryPercent/100 + float64(b.cfg.MinRetriesPerSecond*b.cfg.WindowMs)/1000
+	if float64(retries) >= allowed {
+		return false
+	}
+	b.bucketLocked(now).retries++
+	return true
+}
+
+func (b *RetryBudget) bucketLocked(now time.Time) *retryBudgetBucket {
+	index := now.UnixNano() / int64(b.bucketDuration)
+	bucket := &b.buckets[index%retryBudgetWindowBuckets]
+	if bucket.index != index {
+		*bucket = retryBudgetBucket{index: index}
+	}
+	return bucket
+}
+
+func (b *RetryBudget) countsLocked(now time.Time) (successes, retries int) {
+	index := now.UnixNano() / int64(b.bucketDuration)
+	oldest := index - retryBudgetWindowBuckets + 1
+	for _, bucket := range b.buckets {
+		if bucket.index >= oldest && bucket.index <= index {
+			successes += bucket.successes
+			retries += bucket.retries
+		}
+	}
+	return successes, retries
+}
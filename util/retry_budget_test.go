@@ -0,0 +1,60 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestRetryBudget(cfg *RetryBudgetConfig) (*RetryBudget, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	b := NewRetryBudget(cfg)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestRetryBudgetExhaustsAndRefills(t *testing.T) {
+	b, now := newTestRetryBudget(&RetryBudgetConfig{RetryPercent: 50, MinRetriesPerSecond: -1, WindowMs: 1000})
+	if b.TryRetry() {
+		t.Fatalf("Expected no retry without successful calls")
+	}
+	for i := 0; i < 4; i++ {
+		b.RecordSuccess()
+	}
+	if !b.TryRetry() || !b.TryRetry() {
+		t.Fatalf("Expected 2 retries for 4 successful calls at 50%%")
+	}
+	if b.TryRetry() {
+		t.Errorf("Expected the budget to be exhausted after 2 retries")
+	}
+
+	*now = now.Add(time.Second)
+	b.RecordSuccess()
+	b.RecordSuccess()
+	if !b.TryRetry() {
+		t.Errorf("Expected new successful calls to refill the budget once the old ones left the window")
+	}
+}
+
+func TestWithRetryStopsWhenBudgetIsExhausted(t *testing.T) {
+	b, _ := newTestRetryBudget(&RetryBudgetConfig{MinRetriesPerSecond: -1})
+	tries, allErrs, _ := WithRetry(context.Background(), 5, time.Millisecond, func() (bool, error) {
+		return true, errTry
+	}, WithRetryBudget(b))
+	if tries != 1 || !errors.Is(allErrs[len(allErrs)-1], ErrRetryBudgetExhausted) {
+		t.Errorf("Expected 1 try and ErrRetryBudgetExhausted, got %d tries and %v", tries, allErrs)
+	}
+
+	b.RecordSuccess()
+	b.RecordSuccess()
+	b.RecordSuccess()
+	b.RecordSuccess()
+	b.RecordSuccess()
+	tries, _, _ = WithRetry(context.Background(), 5, time.Millisecond, func() (bool, error) {
+		return true, errTry
+	}, WithRetryBudget(b))
+	if tries != 2 {
+		t.Errorf("Expected 1 retry for 5 successful calls at 20%%, got %d tries", tries)
+	}
+}
@@ -0,0 +1,180 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+type Jitter int
+
+const (
+	JitterNone         Jitter = iota // backoff = min(MaxBackoff, Interval * 2^n)
+	JitterFull                       // random in [0, backoff)
+	JitterEqual                      // backoff/2 + random in [0, backoff/2)
+	JitterDecorrelated               // random in [Interval, previous sleep * 3), capped at MaxBackoff
+)
+
+// RetryPolicy configures WithRetryPolicy, zero values fall back to the defaults of WithRetry.
+// WithRetry runs the same loop with only MaxTries and Interval set.
+type RetryPolicy struct {
+	MaxTries   int
+	Interval   time.Duration // base backoff
+	MaxBackoff time.Duration
+	Jitter     Jitter
+
+	// MaxElapsed stops retrying when the next try would start after MaxElapsed since the first try, 0 means no limit.
+	MaxElapsed time.Duration
+	// AttemptTimeout is the timeout of the ctx passed to each try, 0 means the ctx of the caller.
+	AttemptTimeout time.Duration
+
+	// IsRetryable decides whether a failed try is retried, default every error except context.Canceled
+	// (and context.DeadlineExceeded of the caller ctx, which is checked separately).
+	IsRetryable func(err error) bool
+	// OnAttempt is called after every try, backoff is the sleep before the next try, 0 if there is none.
+	OnAttempt func(ctx context.Context, try int, err error, backoff time.Duration)
+
+	// Budget, if set, records the successful tries and stops retrying once the retries of all its users
+	// exceed its share of the successful calls.
+	Budget *RetryBudget
+}
+
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+func defaultIsRetryable(err error) bool {
+	return !errors.Is(err, context.Canceled)
+}
+
+// WithRetryPolicy calls operationFunc until it succeeds, the error is not retryable, the tries or the elapsed time
+// are used up, or ctx is done. The sleep between tries is interrupted when ctx is done.
+// allTries is the number of tries, allErrs is the "returned error" of all tries, lastErr is the error of the last try.
+func WithRetryPolicy(ctx context.Context, policy *RetryPolicy, operationFunc func(ctx context.Context) error) (allTries int, allErrs []error, lastErr error) {
+	if ctx == nil {
+		return 0, []error{fmt.Errorf("context cannot be nil")}, fmt.Errorf("context cannot be nil")
+	}
+	if operationFunc == nil {
+		return 0, []error{fmt.Errorf("operationFunc cannot be nil")}, fmt.Errorf("operationFunc cannot be nil")
+	}
+	p := policy.withDefaults()
+	return retryLoop(ctx, p, func(attemptCtx context.Context) (bool, error) {
+		err := operationFunc(attemptCtx)
+		return err != nil && ctx.Err() == nil && p.IsRetryable(err), err
+	})
+}
+
+// withDefaults returns a copy of p with zero values replaced by the defaults, p may be nil.
+func (p *RetryPolicy) withDefaults() RetryPolicy {
+	c := RetryPolicy{}
+	if p != nil {
+		c = *p
+	}
+	if c.MaxTries <= 0 {
+		c.MaxTries = DefaultMaxTries
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultRetryInterval
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = MaxBackoff
+	}
+	if c.IsRetryable == nil {
+		c.IsRetryable = defaultIsRetryable
+	}
+	return c
+}
+
+// retryLoop is shared by WithRetry and WithRetryPolicy, operationFunc reports whether its try should be retried.
+// A try counts as a success for the budget when it has no error and is not retried.
+func retryLoop(ctx context.Context, p RetryPolicy, operationFunc func(ctx context.Context) (shouldRetry bool, err error)) (allTries int, allErrs []error, lastErr error) {
+	start := time.Now()
+	prevBackoff := p.Interval
+	allErrs = make([]error, 0, p.MaxTries)
+	for i := 1; i <= p.MaxTries; i++ {
+		var (
+			shouldRetry bool
+			err         error
+		)
+		runAttempt(ctx, p.AttemptTimeout, func(attemptCtx context.Context) {
+			shouldRetry, err = operationFunc(attemptCtx)
+		})
+		lastErr = err
+		if err != nil {
+			allErrs = append(allErrs, fmt.Errorf("try %d/%d failed: %w", i, p.MaxTries, err))
+		} else if !shouldRetry {
+			p.Budget.RecordSuccess()
+		}
+
+		var backoff time.Duration
+		retry := shouldRetry && i < p.MaxTries
+		if retry {
+			backoff = p.backoff(i, prevBackoff)
+			prevBackoff = backoff
+			if p.MaxElapsed > 0 && time.Since(start)+backoff > p.MaxElapsed {
+				retry = false
+				backoff = 0
+			}
+		}
+		if retry && !p.Budget.TryRetry() {
+			allErrs = append(allErrs, ErrRetryBudgetExhausted)
+			retry = false
+			backoff = 0
+		}
+		if p.OnAttempt != nil {
+			p.OnAttempt(ctx, i, err, backoff)
+		}
+		if !retry {
+			return i, allErrs, lastErr
+		}
+
+		if err := sleepCtx(ctx, backoff); err != nil {
+			lastErr = fmt.Errorf("canceled after %d/%d try: %w", i, p.MaxTries, err)
+			allErrs = append(allErrs, lastErr)
+			return i, allErrs, lastErr
+		}
+	}
+	return p.MaxTries, allErrs, lastErr
+}
+
+func runAttempt(ctx context.Context, timeout time.Duration, operationFunc func(ctx context.Context)) {
+	if timeout <= 0 {
+		operationFunc(ctx)
+		return
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	operationFunc(attemptCtx)
+}
+
+// backoff returns the sleep after try, prevBackoff is the previous sleep for decorrelated jitter.
+func (p *RetryPolicy) backoff(try int, prevBackoff time.Duration) time.Duration {
+	if p.Jitter == JitterDecorrelated {
+		upper := prevBackoff * 3
+		if upper > p.MaxBackoff || upper <= 0 {
+			upper = p.MaxBackoff
+		}
+		if upper <= p.Interval {
+			return upper
+		}
+		return p.Interval + rand.N(upper-p.Interval)
+	}
+
+	backoff := p.MaxBackoff
+	if try-1 < 62 {
+		if b := time.Duration(1<<uint(try-1)) * p.Interval; b > 0 && b < p.MaxBackoff {
+			backoff = b
+		}
+	}
+	switch p.Jitter {
+	case JitterFull:
+		return rand.N(backoff)
+	case JitterEqual:
+		half := backoff / 2
+		if half <= 0 {
+			return backoff
+		}
+		return half + rand.N(half)
+	}
+	return backoff
+}
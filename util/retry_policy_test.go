@@ -0,0 +1,101 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTry = errors.New("try failed")
+
+func TestRetryPolicyJitterBounds(t *testing.T) {
+	p := (&RetryPolicy{Interval: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}).withDefaults()
+	for i := 0; i < 1000; i++ {
+		p.Jitter = JitterFull
+		if b := p.backoff(3, 0); b < 0 || b >= 40*time.Millisecond {
+			t.Fatalf("Expected full jitter in [0, 40ms), got %v", b)
+		}
+		p.Jitter = JitterEqual
+		if b := p.backoff(3, 0); b < 20*time.Millisecond || b >= 40*time.Millisecond {
+			t.Fatalf("Expected equal jitter in [20ms, 40ms), got %v", b)
+		}
+		p.Jitter = JitterDecorrelated
+		if b := p.backoff(3, 20*time.Millisecond); b < 10*time.Millisecond || b >= 60*time.Millisecond {
+			t.Fatalf("Expected decorrelated jitter in [10ms, 60ms), got %v", b)
+		}
+		if b := p.backoff(3, time.Second); b > 100*time.Millisecond {
+			t.Fatalf("Expected decorrelated jitter capped at 100ms, got %v", b)
+		}
+	}
+	p.Jitter = JitterNone
+	if b := p.backoff(10, 0); b != 100*time.Millisecond {
+		t.Errorf("Expected the backoff capped at 100ms, got %v", b)
+	}
+}
+
+func TestRetryPolicyMaxElapsed(t *testing.T) {
+	tries, _, err := WithRetryPolicy(context.Background(), &RetryPolicy{
+		MaxTries:   10,
+		Interval:   20 * time.Millisecond,
+		MaxElapsed: 50 * time.Millisecond,
+	}, func(ctx context.Context) error {
+		return errTry
+	})
+	// sleeps of 20ms and 40ms, the second one would end after 60ms
+	if tries != 2 || !errors.Is(err, errTry) {
+		t.Errorf("Expected 2 tries before MaxElapsed, got %d tries and %v", tries, err)
+	}
+}
+
+func TestRetryPolicyAttemptTimeout(t *testing.T) {
+	tries, _, err := WithRetryPolicy(context.Background(), &RetryPolicy{
+		MaxTries:       2,
+		AttemptTimeout: 10 * time.Millisecond,
+	}, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if tries != 2 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected each try to time out and be retried, got %d tries and %v", tries, err)
+	}
+}
+
+func TestRetryPolicyIsRetryable(t *testing.T) {
+	errFatal := errors.New("fatal")
+	tries, _, err := WithRetryPolicy(context.Background(), &RetryPolicy{
+		MaxTries:    5,
+		Interval:    time.Millisecond,
+		IsRetryable: func(err error) bool { return !errors.Is(err, errFatal) },
+	}, func() func(ctx context.Context) error {
+		try := 0
+		return func(ctx context.Context) error {
+			try++
+			if try == 2 {
+				return errFatal
+			}
+			return errTry
+		}
+	}())
+	if tries != 2 || !errors.Is(err, errFatal) {
+		t.Errorf("Expected to stop at the non retryable error, got %d tries and %v", tries, err)
+	}
+
+	tries, _, _ = WithRetryPolicy(context.Background(), &RetryPolicy{MaxTries: 5}, func(ctx context.Context) error {
+		return context.Canceled
+	})
+	if tries != 1 {
+		t.Errorf("Expected context.Canceled not to be retried by default, got %d tries", tries)
+	}
+}
+
+func TestWithRetryRetriesWithoutError(t *testing.T) {
+	polls := 0
+	tries, allErrs, err := WithRetry(context.Background(), 5, time.Millisecond, func() (bool, error) {
+		polls++
+		return polls < 3, nil
+	})
+	if tries != 3 || len(allErrs) != 0 || err != nil {
+		t.Errorf("Expected 3 tries without errors, got %d tries, %v and %v", tries, allErrs, err)
+	}
+}
@@ -0,0 +1,16 @@
+package trace
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestIDAndTraceIDDoNotShareKey(t *testing.T) {
+	ctx := SetTraceIDToCtx(SetRequestIDToCtx(context.Background(), "rid-1"), "tid-1")
+	if rid := GetRequestIDFromCtx(ctx); rid != "rid-1" {
+		t.Errorf("Expected request id rid-1, got %s", rid)
+	}
+	if tid := GetTraceIDFromCtx(ctx); tid != "tid-1" {
+		t.Errorf("Expected trace id tid-1, got %s", tid)
+	}
+}
@@ -1,8 +1,11 @@
 package trace
 
+// Context keys are distinct types, aliases of struct{} would make the request id and trace id share one key.
+// Up to the alias version, ctx.Value(struct{}{}) returned whichever id was set last, read the ids with
+// GetRequestIDFromCtx and GetTraceIDFromCtx instead.
 type (
-	ContextKeyRequestID = struct{}
-	ContextKeyTraceID   = struct{}
+	ContextKeyRequestID struct{}
+	ContextKeyTraceID   struct{}
 )
 
 const (